@@ -13,7 +13,7 @@ import (
 	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/datastore"
 	"github.com/Tilo-K/riot/analytics/data_aggregation"
-	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
 	uuid "github.com/nu7hatch/gouuid"
 )
 
@@ -194,9 +194,9 @@ func (a *Aggregator) markDone(ctx context.Context, key *datastore.Key, tok strin
 	}
 }
 
-// MatchExists returns true if the match ID for the given region is already
-// stored.
-func (a *Aggregator) MatchExists(ctx context.Context, r region.Region, id int64) (bool, error) {
+// MatchExists returns true if the match ID for the given regional route is
+// already stored.
+func (a *Aggregator) MatchExists(ctx context.Context, r v5region.V5Region, id string) (bool, error) {
 	var current lockvalue
 	key := a.gameKey(r, id)
 	err := a.ds.Get(ctx, key, &current)
@@ -209,10 +209,10 @@ func (a *Aggregator) MatchExists(ctx context.Context, r region.Region, id int64)
 	return false, err
 }
 
-func (a *Aggregator) gameKey(r region.Region, id int64) *datastore.Key {
+func (a *Aggregator) gameKey(r v5region.V5Region, id string) *datastore.Key {
 	return &datastore.Key{
 		Kind:      fmt.Sprintf("aggregator-save-match-%s:%s:%s", r, a.dataset, a.table),
-		ID:        id,
+		Name:      id,
 		Namespace: a.ns,
 	}
 }
@@ -223,7 +223,7 @@ type uploadKeyValue struct {
 	Value data_aggregation.Match
 }
 
-// SaveMatches stores the match from the given region. Returns whether the
+// SaveMatches stores the matches. Returns whether the
 // function stored the match. If not, and there was no error, then the match
 // was already cached.
 func (a *Aggregator) SaveMatches(ctx context.Context, matches []data_aggregation.Match) error {
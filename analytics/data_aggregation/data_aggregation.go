@@ -11,23 +11,24 @@ import (
 	"github.com/Tilo-K/riot/apiclient"
 	"github.com/Tilo-K/riot/constants/queue"
 	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
 )
 
 // Match is the serialized format of match data. Match or Timeline may be nil
-// if the data is unavailable from the API. Matches are unique by ID and
-// Region.
+// if the data is unavailable from the API. Matches are unique by ID, such as
+// "NA1_4500000000", and regional route.
 type Match struct {
-	ID       int64
-	Region   region.Region
+	ID       string
+	Region   v5region.V5Region
 	Match    *apiclient.Match
 	Timeline *apiclient.MatchTimeline
 }
 
 // Sink stores match data in an aggregate source.
 type Sink interface {
-	// MatchExists returns true if the match ID for the given region is already
-	// stored in the sink.
-	MatchExists(ctx context.Context, r region.Region, id int64) (bool, error)
+	// MatchExists returns true if the match ID for the given regional route is
+	// already stored in the sink.
+	MatchExists(ctx context.Context, r v5region.V5Region, id string) (bool, error)
 
 	// SaveMatches saves the matches into the sink. It is not an error to save a
 	// match that has already been saved. Sink must not duplicate the match, but
@@ -52,7 +53,7 @@ func NewAggregator(c apiclient.Client, s Sink) *Aggregator {
 	}
 }
 
-// AggregateChallengerLeagueMatches aggregates all games from accounts
+// AggregateChallengerLeagueMatches aggregates all games from players
 // currently in challenger league in the given region in queue. Only games
 // since the given begin time are considered. The zero time value indicates
 // that all games should be considered.
@@ -61,66 +62,49 @@ func (a Aggregator) AggregateChallengerLeagueMatches(ctx context.Context, r regi
 	if err != nil {
 		return err
 	}
-	accountIDs := a.getAccountIDsInLeague(ctx, r, league)
-	matches := a.GetMatchIDsForAccounts(ctx, r, q, since, accountIDs)
-	a.UploadMatches(ctx, r, matches)
+	puuids := a.getPUUIDsInLeague(ctx, r, league)
+	route := v5region.ForRegion(r)
+	matches := a.GetMatchIDsForPUUIDs(ctx, route, q, since, puuids)
+	a.UploadMatches(ctx, route, matches)
 	return nil
 }
 
-func (a Aggregator) GetMatchIDsForAccounts(ctx context.Context, r region.Region, q queue.Queue, since time.Time, accountIDs []string) map[int64]struct{} {
-	// Query recent matches for each account.
-	opts := apiclient.GetMatchlistOptions{
-		Queue:     []queue.Queue{q},
-		BeginTime: &since,
+// GetMatchIDsForPUUIDs returns the IDs of the matches in queue since the given
+// time of the players with the given PUUIDs, which are not yet stored in the
+// sink.
+func (a Aggregator) GetMatchIDsForPUUIDs(ctx context.Context, r v5region.V5Region, q queue.Queue, since time.Time, puuids []string) map[string]struct{} {
+	opts := apiclient.GetMatchIdsOptions{
+		Queue:     q,
+		StartTime: since,
 	}
-	matches := make(map[int64]struct{})
-	matchIDs := make(chan int64)
+	matches := make(map[string]struct{})
+	matchIDs := make(chan string)
 	wg := sync.WaitGroup{}
 	done := make(chan bool)
 
-	for _, account := range accountIDs {
+	for _, puuid := range puuids {
 		wg.Add(1)
-		account := account
-		// Process each account concurrently.
+		puuid := puuid
+		// Process each player concurrently.
 		go func() {
 			defer wg.Done()
-			matchlist, err := a.client.GetMatchlist(ctx, r, account, &opts)
-			if err == nil {
-				var (
-					subwg   sync.WaitGroup
-					subdone = make(chan bool)
-				)
-				// Process each account match concurrently.
-				for _, m := range matchlist.Matches {
-					subwg.Add(1)
-					m := m
-					go func() {
-						defer subwg.Done()
-						exists, err := a.sink.MatchExists(ctx, r, m.GameID)
-						if err != nil {
-							log.Printf("MatchExists failed for region %s game %d: %v", r, m.GameID, err)
-						}
-						if err == nil && !exists {
-							select {
-							case matchIDs <- m.GameID:
-							case <-ctx.Done():
-								return
-							}
-						}
-					}()
-
-					// Block until cancelled or all matches processed.
-					go func() {
-						subwg.Wait()
-						subdone <- true
-					}()
+			opts := opts
+			ids, err := apiclient.GetAllMatchIds(ctx, a.client, r, puuid, &opts)
+			if err != nil {
+				log.Printf("GetMatchIds failed for region %s player %s: %v", r, puuid, err)
+			}
+			for _, id := range ids {
+				exists, err := a.sink.MatchExists(ctx, r, id)
+				if err != nil {
+					log.Printf("MatchExists failed for region %s match %s: %v", r, id, err)
+				}
+				if err == nil && !exists {
 					select {
+					case matchIDs <- id:
 					case <-ctx.Done():
-					case <-subdone:
+						return
 					}
 				}
-			} else {
-				log.Printf("GetMatchlist failed for region %s account %s: %v", r, account, err)
 			}
 		}()
 	}
@@ -145,51 +129,80 @@ func (a Aggregator) GetMatchIDsForAccounts(ctx context.Context, r region.Region,
 	return matches
 }
 
-func (a Aggregator) UploadMatches(ctx context.Context, r region.Region, matches map[int64]struct{}) {
-	// Retrieve match and timeline data for each match.
-	wg := sync.WaitGroup{}
+// UploadMatches retrieves the match and timeline data of each match
+// concurrently, and saves them into the sink.
+func (a Aggregator) UploadMatches(ctx context.Context, r v5region.V5Region, matches map[string]struct{}) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ids []string
 	for m := range matches {
-		match, err := a.client.GetMatch(ctx, r, m)
-		if err != nil && err != apiclient.ErrDataNotFound {
-			log.Printf("GetMatch failed for region %s game %d: %v", r, m, err)
-			continue
+		ids = append(ids, m)
+	}
+	matchResults := apiclient.GetMatches(ctx, a.client, r, ids, nil)
+	timelineResults := apiclient.GetMatchTimelines(ctx, a.client, r, ids, nil)
+
+	// pending holds the matches waiting for their other part, or nil for those
+	// with a failed part. Each match is saved once both parts are retrieved.
+	var (
+		pending = make(map[string]*Match)
+		wg      sync.WaitGroup
+	)
+	complete := func(id, method string, err error, set func(m *Match)) {
+		m, seen := pending[id]
+		switch {
+		case !seen:
+			m = &Match{ID: id, Region: r}
+			pending[id] = m
+		case m == nil:
+			return
 		}
-		timeline, err := a.client.GetMatchTimeline(ctx, r, m)
 		if err != nil && err != apiclient.ErrDataNotFound {
-			log.Printf("GetMatchTimeline failed for region %s game %d: %v", r, m, err)
-			continue
+			log.Printf("%s failed for region %s match %s: %v", method, r, id, err)
+			pending[id] = nil
+			return
+		}
+		if err == nil {
+			set(m)
 		}
-		upload := Match{
-			ID:       m,
-			Region:   r,
-			Match:    match,
-			Timeline: timeline,
+		if !seen {
+			return
 		}
+		delete(pending, id)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := a.sink.SaveMatches(ctx, []Match{upload})
+			err := a.sink.SaveMatches(ctx, []Match{*m})
 			if err != nil {
-				log.Printf("SaveMatches failed for region %s game %d: %v", upload.Region, upload.ID, err)
+				log.Printf("SaveMatches failed for region %s match %s: %v", m.Region, m.ID, err)
 			}
 		}()
 	}
-	done := make(chan bool)
-	go func() {
-		wg.Wait()
-		done <- true
-	}()
-	select {
-	case <-ctx.Done():
-	case <-done:
+	for matchResults != nil || timelineResults != nil {
+		select {
+		case res, ok := <-matchResults:
+			if !ok {
+				matchResults = nil
+				continue
+			}
+			complete(res.ID, "GetMatch", res.Err, func(m *Match) { m.Match = res.Match })
+		case res, ok := <-timelineResults:
+			if !ok {
+				timelineResults = nil
+				continue
+			}
+			complete(res.ID, "GetMatchTimeline", res.Err, func(m *Match) { m.Timeline = res.Timeline })
+		}
 	}
+	wg.Wait()
 }
-func (a Aggregator) getAccountIDsInLeague(ctx context.Context, r region.Region, league *apiclient.LeagueList) []string {
+
+func (a Aggregator) getPUUIDsInLeague(ctx context.Context, r region.Region, league *apiclient.LeagueList) []string {
 	var (
-		accounts   = make(chan string)
-		accountIDs []string
-		wg         sync.WaitGroup
-		done       = make(chan bool)
+		players = make(chan string)
+		puuids  []string
+		wg      sync.WaitGroup
+		done    = make(chan bool)
 	)
 	for _, entry := range league.Entries {
 		entry := entry
@@ -203,7 +216,7 @@ func (a Aggregator) getAccountIDsInLeague(ctx context.Context, r region.Region,
 			}
 			select {
 			case <-ctx.Done():
-			case accounts <- summoner.AccountID:
+			case players <- summoner.PUUID:
 			}
 		}()
 	}
@@ -218,11 +231,11 @@ func (a Aggregator) getAccountIDsInLeague(ctx context.Context, r region.Region,
 		select {
 		case <-ctx.Done():
 			more = false
-		case id := <-accounts:
-			accountIDs = append(accountIDs, id)
+		case id := <-players:
+			puuids = append(puuids, id)
 		case <-done:
 			more = false
 		}
 	}
-	return accountIDs
+	return puuids
 }
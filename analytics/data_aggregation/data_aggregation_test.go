@@ -0,0 +1,90 @@
+package data_aggregation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/apiclient/apiclienttest"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/tier"
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+// memorySink stores matches in memory.
+type memorySink struct {
+	lock    sync.Mutex
+	matches map[string]Match
+}
+
+func (s *memorySink) MatchExists(ctx context.Context, r v5region.V5Region, id string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.matches[string(r)+"/"+id]
+	return ok, nil
+}
+
+func (s *memorySink) SaveMatches(ctx context.Context, ms []Match) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, m := range ms {
+		s.matches[string(m.Region)+"/"+m.ID] = m
+	}
+	return nil
+}
+
+func TestAggregateChallengerLeagueMatches(t *testing.T) {
+	ctx := context.Background()
+	a, b := apiclienttest.NewSummoner("a"), apiclienttest.NewSummoner("b")
+	f := apiclienttest.NewFake()
+	f.Return("GetChallengerLeague", apiclienttest.NewLeagueList(tier.Challenger, queue.RankedSolo5x5, a, b))
+	f.OnGetBySummonerID(func(ctx context.Context, r region.Region, id string) (*apiclient.Summoner, error) {
+		for _, s := range []*apiclient.Summoner{a, b} {
+			if s.ID == id {
+				return s, nil
+			}
+		}
+		return nil, apiclient.ErrDataNotFound
+	})
+	f.OnGetMatchIds(func(ctx context.Context, r v5region.V5Region, puuid string, opts *apiclient.GetMatchIdsOptions) ([]string, error) {
+		if r != v5region.Americas || opts.Queue != queue.RankedSolo5x5 || opts.Start > 0 {
+			return []string{}, nil
+		}
+		if puuid == a.PUUID {
+			return []string{"NA1_1", "NA1_2", "NA1_3"}, nil
+		}
+		return []string{"NA1_2", "NA1_4"}, nil
+	})
+	f.OnGetMatch(func(ctx context.Context, r v5region.V5Region, id string) (*apiclient.Match, error) {
+		if id == "NA1_4" {
+			return nil, apiclient.ErrServiceUnavailable
+		}
+		return apiclienttest.NewMatch(id, time.Unix(0, 0), a.PUUID, b.PUUID), nil
+	})
+	f.Return("GetMatchTimeline", &apiclient.MatchTimeline{})
+
+	// NA1_1 is already stored.
+	sink := &memorySink{matches: map[string]Match{"AMERICAS/NA1_1": {}}}
+	if err := NewAggregator(f, sink).AggregateChallengerLeagueMatches(ctx, region.NA1, queue.RankedSolo5x5, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for key, m := range sink.matches {
+		got = append(got, key)
+		if m.ID != "" && (m.Match == nil || m.Timeline == nil || m.Match.Metadata.MatchID != m.ID) {
+			t.Errorf("%s: got %+v", key, m)
+		}
+	}
+	sort.Strings(got)
+	if want := "[AMERICAS/NA1_1 AMERICAS/NA1_2 AMERICAS/NA1_3]"; fmt.Sprint(got) != want {
+		t.Errorf("got matches %v, want %s", got, want)
+	}
+	if n := len(f.Calls("GetMatch")); n != 3 {
+		t.Errorf("got %d GetMatch calls, want 3", n)
+	}
+}
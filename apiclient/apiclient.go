@@ -78,8 +78,9 @@ type Client interface {
 	// Deprecated: This uses the Match V4 api, which isn't active anymore
 	GetMatchlist(ctx context.Context, r region.Region, accountID string, opts *GetMatchlistOptions) (*Matchlist, error)
 
-	// GetMatchIds returns a ist of matchIds for games played on a account with the given PUUID
-	// and filtered using given filter parameters, if any.
+	// GetMatchIds returns a page of the IDs of matches played on the account
+	// with the given PUUID, most recent first, and filtered using given filter
+	// parameters, if any. Use NewMatchIdsIterator() to page through all of them.
 	GetMatchIds(ctx context.Context, r v5region.V5Region, PUUID string, opts *GetMatchIdsOptions) ([]string, error)
 
 	// GetRecentMatchlist returns the last 20 matches played on the given account ID.
@@ -144,13 +145,10 @@ func (c *client) dispatchAndUnmarshalWithUniquifier(ctx context.Context, r regio
 		return res, err
 	}
 	if res.StatusCode != http.StatusOK {
-		if res.StatusCode == http.StatusBadRequest {
+		err := errorForResponse(res)
+		if err == ErrBadRequest {
 			fmt.Println("Invalid request: ", res.Request.URL)
 		}
-		err, ok := httpErrors[res.StatusCode]
-		if !ok {
-			err = ErrBadHTTPStatus
-		}
 		return res, err
 	}
 
@@ -173,13 +171,10 @@ func (c *client) dispatchAndUnmarshalWithUniquifierV5(ctx context.Context, r v5r
 		return res, err
 	}
 	if res.StatusCode != http.StatusOK {
-		if res.StatusCode == http.StatusBadRequest {
+		err := errorForResponse(res)
+		if err == ErrBadRequest {
 			fmt.Println("Invalid request: ", res.Request.URL)
 		}
-		err, ok := httpErrors[res.StatusCode]
-		if !ok {
-			err = ErrBadHTTPStatus
-		}
 		return res, err
 	}
 
@@ -0,0 +1,195 @@
+package apiclienttest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/champion"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/tier"
+)
+
+const (
+	// matchDuration is the duration of built matches.
+	matchDuration = 30 * time.Minute
+
+	// gameVersion is the game version of built matches.
+	gameVersion = "14.1.555.5555"
+)
+
+// teamPositions are the positions of the players of each team, in the order
+// of the participants of a match.
+var teamPositions = []string{"TOP", "JUNGLE", "MIDDLE", "BOTTOM", "UTILITY"}
+
+// matchChampions are the champions played by the participants of a match.
+var matchChampions = []champion.Champion{
+	champion.Garen, champion.LeeSin, champion.Ahri, champion.Jinx, champion.Thresh,
+	champion.Darius, champion.Elise, champion.Zed, champion.Caitlyn, champion.Lulu,
+}
+
+// ID returns an identifier that is derived from the seed, in the format of an
+// encrypted Riot API ID. Equal seeds yield equal IDs.
+func ID(seed string, length int) string {
+	var id string
+	for i := 0; len(id) < length; i++ {
+		sum := sha256.Sum256([]byte(seed + "/" + strconv.Itoa(i)))
+		id += hex.EncodeToString(sum[:])
+	}
+	return id[:length]
+}
+
+// NewSummoner returns a level 30 summoner with the given name, and IDs derived
+// from the name.
+func NewSummoner(name string) *apiclient.Summoner {
+	return &apiclient.Summoner{
+		ProfileIconID: 4568,
+		Name:          name,
+		PUUID:         ID("puuid:"+name, 78),
+		SummonerLevel: 30,
+		AccountID:     ID("account:"+name, 56),
+		ID:            ID("summoner:"+name, 47),
+		RevisionDate:  time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// makeSlice sets the slice pointed to by ptr to a slice of n zero values. It
+// allocates the slices of match fields, whose element types are unnamed.
+func makeSlice(ptr interface{}, n int) {
+	v := reflect.ValueOf(ptr).Elem()
+	v.Set(reflect.MakeSlice(v.Type(), n, n))
+}
+
+// NewMatch returns a ranked solo match on Summoner's Rift with ID such as
+// "NA1_4500000000", created at the given time. The first five PUUIDs are the
+// players of the blue team, which wins, and the next five those of the red
+// team. Players without a given PUUID get one derived from the match ID.
+func NewMatch(id string, created time.Time, puuids ...string) *apiclient.Match {
+	if len(puuids) > 10 {
+		panic(fmt.Sprintf("apiclienttest: %d players in match %s", len(puuids), id))
+	}
+	players := make([]string, 10)
+	copy(players, puuids)
+	for i := range players {
+		if players[i] == "" {
+			players[i] = ID(fmt.Sprintf("puuid:%s/%d", id, i), 78)
+		}
+	}
+
+	var m apiclient.Match
+	m.Metadata.DataVersion = "2"
+	m.Metadata.MatchID = id
+	m.Metadata.Participants = players
+
+	platform, gameID := id, ""
+	if i := strings.LastIndex(id, "_"); i >= 0 {
+		platform, gameID = id[:i], id[i+1:]
+	}
+	start := created.Add(30 * time.Second)
+	info := &m.Info
+	info.GameCreation = created.UnixNano() / int64(time.Millisecond)
+	info.GameStartTimestamp = start.UnixNano() / int64(time.Millisecond)
+	info.GameEndTimestamp = start.Add(matchDuration).UnixNano() / int64(time.Millisecond)
+	info.GameDuration = int(matchDuration / time.Second)
+	info.GameID, _ = strconv.ParseInt(gameID, 10, 64)
+	info.GameMode = "CLASSIC"
+	info.GameName = "teambuilder-match-" + gameID
+	info.GameType = "MATCHED_GAME"
+	info.GameVersion = gameVersion
+	info.MapID = 11
+	info.PlatformID = platform
+	info.QueueID = int(queue.RankedSolo5x5)
+
+	makeSlice(&info.Participants, len(players))
+	kills := map[int]int{}
+	for i, puuid := range players {
+		p := &info.Participants[i]
+		name := fmt.Sprintf("Player %d", i+1)
+		p.ParticipantID = i + 1
+		p.Puuid = puuid
+		p.SummonerID = ID("summoner:"+puuid, 47)
+		p.SummonerName = name
+		p.RiotIDGameName = name
+		p.RiotIDTagline = platform
+		p.SummonerLevel = 30 + 7*i
+		p.ProfileIcon = 4568
+		p.TeamID = 100
+		p.Win = i < 5
+		if !p.Win {
+			p.TeamID = 200
+		}
+		p.TeamPosition = teamPositions[i%5]
+		p.IndividualPosition = p.TeamPosition
+		p.Lane = p.TeamPosition
+		p.Role = "SOLO"
+		p.ChampionID = int(matchChampions[i])
+		p.ChampionName = matchChampions[i].String()
+		p.ChampLevel = 14 + i%4
+		p.Kills = 2 + (i*3)%7
+		p.Deaths = 1 + (i*5)%6
+		p.Assists = 3 + (i*7)%9
+		p.TotalMinionsKilled = 30 + (i*37)%180
+		p.GoldEarned = 8000 + 350*p.Kills + 20*p.TotalMinionsKilled
+		p.GoldSpent = p.GoldEarned - 400
+		p.VisionScore = 10 + (i*11)%40
+		p.TimePlayed = info.GameDuration
+		p.Summoner1ID = 4
+		p.Summoner2ID = 14
+		kills[p.TeamID] += p.Kills
+	}
+
+	makeSlice(&info.Teams, 2)
+	for i := range info.Teams {
+		t := &info.Teams[i]
+		t.TeamID = 100 * (i + 1)
+		t.Win = i == 0
+		t.Objectives.Champion.Kills = kills[t.TeamID]
+		t.Objectives.Tower.First = t.Win
+		t.Objectives.Tower.Kills = 3
+		if t.Win {
+			t.Objectives.Tower.Kills = 9
+			t.Objectives.Inhibitor.Kills = 1
+		}
+	}
+	return &m
+}
+
+// NewLeagueList returns a league of the tier and queue with an entry for each
+// summoner, in order of decreasing league points.
+func NewLeagueList(t tier.Tier, q queue.Queue, summoners ...*apiclient.Summoner) *apiclient.LeagueList {
+	l := &apiclient.LeagueList{
+		LeagueID: ID(fmt.Sprintf("league:%s/%s", t, q), 36),
+		Tier:     t,
+		Queue:    q,
+		Name:     "Tryndamere's Duelists",
+	}
+	apex := t == tier.Challenger || t == tier.Grandmaster || t == tier.Master
+	for i, s := range summoners {
+		// Apex leagues rank players by unbounded league points, and other
+		// leagues by at most 100 points in each division.
+		lp := 1200 - 25*i
+		if !apex {
+			lp = 99 - i
+		}
+		if lp < 0 {
+			lp = 0
+		}
+		wins := 150 - i%100
+		l.Entries = append(l.Entries, apiclient.LeagueItem{
+			Rank:         "I",
+			HotStreak:    i%4 == 0,
+			Wins:         wins,
+			Losses:       wins - 20,
+			Veteran:      i%3 == 0,
+			SummonerName: s.Name,
+			SummonerID:   s.ID,
+			LeaguePoints: lp,
+		})
+	}
+	return l
+}
@@ -0,0 +1,181 @@
+// Package apiclienttest provides a programmable fake of apiclient.Client, and
+// helpers to build realistic API values for tests.
+//
+// The methods of Fake are generated from the Client interface by the program
+// in the generator directory. Run go generate in this directory after
+// changing the interface.
+package apiclienttest
+
+//go:generate go run ./generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+// Option configures a Fake.
+type Option func(*Fake)
+
+// WithClock sets the clock used to inject latency, for example a
+// ratelimittest.FakeClock.
+func WithClock(c ratelimit.Clock) Option {
+	return func(f *Fake) {
+		f.clock = c
+	}
+}
+
+// Call is a call made to a Fake.
+type Call struct {
+	Method string
+
+	// Args are the arguments after the context.
+	Args []interface{}
+}
+
+// response is a canned response.
+type response struct {
+	value interface{}
+	err   error
+}
+
+// Fake implements apiclient.Client with programmed responses, and records the
+// calls made to it. Methods without responses or handlers return
+// apiclient.ErrDataNotFound, like the API for missing data. Fake is
+// threadsafe.
+type Fake struct {
+	clock ratelimit.Clock
+
+	lock      sync.Mutex
+	responses map[string][]response
+	handlers  map[string]interface{}
+	latency   map[string]time.Duration
+	calls     []Call
+}
+
+var _ apiclient.Client = (*Fake)(nil)
+
+// NewFake returns a Fake without programmed responses.
+func NewFake(opts ...Option) *Fake {
+	f := &Fake{
+		clock:     ratelimit.SystemClock,
+		responses: make(map[string][]response),
+		handlers:  make(map[string]interface{}),
+		latency:   make(map[string]time.Duration),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// resultType returns the result type of the method, and panics if the Client
+// has no such method.
+func resultType(method string) reflect.Type {
+	t, ok := results[method]
+	if !ok {
+		panic(fmt.Sprintf("apiclienttest: apiclient.Client has no method %s", method))
+	}
+	return t
+}
+
+func (f *Fake) respond(method string, r response) {
+	resultType(method)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.handlers, method)
+	f.responses[method] = append(f.responses[method], r)
+}
+
+// Return adds a canned response to calls of the method, which replaces any
+// handler. Responses are returned in the order they are added, and the last
+// one is repeated. The value must be nil or assignable to the result type of
+// the method, such as *apiclient.Match for GetMatch.
+func (f *Fake) Return(method string, v interface{}) {
+	if v != nil && !reflect.TypeOf(v).AssignableTo(resultType(method)) {
+		panic(fmt.Sprintf("apiclienttest: %T is not a result of %s", v, method))
+	}
+	f.respond(method, response{value: v})
+}
+
+// Fail adds a canned error response to calls of the method, in the same way
+// as Return.
+func (f *Fake) Fail(method string, err error) {
+	f.respond(method, response{err: err})
+}
+
+// handle answers calls to the method with fn, which the generated methods
+// convert to the function type of the method.
+func (f *Fake) handle(method string, fn interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.responses, method)
+	f.handlers[method] = fn
+}
+
+// SetLatency delays calls to the method by d, or calls to all methods without
+// their own latency if method is empty. Delayed calls return the error of the
+// context if it is done first.
+func (f *Fake) SetLatency(method string, d time.Duration) {
+	if method != "" {
+		resultType(method)
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.latency[method] = d
+}
+
+// Calls returns the calls to the method in the order they were made, or all
+// calls if method is empty.
+func (f *Fake) Calls(method string) []Call {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var calls []Call
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// call records a call, waits for the latency, and returns either the handler
+// of the method or the next canned response.
+func (f *Fake) call(ctx context.Context, method string, args ...interface{}) (interface{}, interface{}, error) {
+	f.lock.Lock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	d, ok := f.latency[method]
+	if !ok {
+		d = f.latency[""]
+	}
+	f.lock.Unlock()
+
+	if d > 0 {
+		t := f.clock.NewTimer(d)
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if h, ok := f.handlers[method]; ok {
+		return h, nil, nil
+	}
+	rs := f.responses[method]
+	if len(rs) == 0 {
+		return nil, nil, apiclient.ErrDataNotFound
+	}
+	if len(rs) > 1 {
+		f.responses[method] = rs[1:]
+	}
+	return nil, rs[0].value, rs[0].err
+}
@@ -0,0 +1,444 @@
+// Code generated by generator.go; DO NOT EDIT.
+
+package apiclienttest
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/champion"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+// results holds the result type of each method, which canned responses must
+// be assignable to.
+var results = map[string]reflect.Type{
+	"GetAllChampionMasteries":          reflect.TypeOf((*[]apiclient.ChampionMastery)(nil)).Elem(),
+	"GetAllChampionMasteriesByPuuid":   reflect.TypeOf((*[]apiclient.ChampionMastery)(nil)).Elem(),
+	"GetChampionMastery":               reflect.TypeOf((**apiclient.ChampionMastery)(nil)).Elem(),
+	"GetChampionMasteryScore":          reflect.TypeOf((*int)(nil)).Elem(),
+	"GetChampions":                     reflect.TypeOf((**apiclient.ChampionList)(nil)).Elem(),
+	"GetChampionByID":                  reflect.TypeOf((**apiclient.Champion)(nil)).Elem(),
+	"GetChallengerLeague":              reflect.TypeOf((**apiclient.LeagueList)(nil)).Elem(),
+	"GetGrandmasterLeague":             reflect.TypeOf((**apiclient.LeagueList)(nil)).Elem(),
+	"GetMasterLeague":                  reflect.TypeOf((**apiclient.LeagueList)(nil)).Elem(),
+	"GetAllLeaguePositionsForSummoner": reflect.TypeOf((*[]apiclient.LeaguePosition)(nil)).Elem(),
+	"GetLeagueByID":                    reflect.TypeOf((**apiclient.LeagueList)(nil)).Elem(),
+	"GetMatch":                         reflect.TypeOf((**apiclient.Match)(nil)).Elem(),
+	"GetMatchTimeline":                 reflect.TypeOf((**apiclient.MatchTimeline)(nil)).Elem(),
+	"GetMatchlist":                     reflect.TypeOf((**apiclient.Matchlist)(nil)).Elem(),
+	"GetMatchIds":                      reflect.TypeOf((*[]string)(nil)).Elem(),
+	"GetRecentMatchlist":               reflect.TypeOf((**apiclient.Matchlist)(nil)).Elem(),
+	"GetFeaturedGames":                 reflect.TypeOf((**apiclient.FeaturedGames)(nil)).Elem(),
+	"GetCurrentGameInfoBySummoner":     reflect.TypeOf((**apiclient.CurrentGameInfo)(nil)).Elem(),
+	"GetByAccountID":                   reflect.TypeOf((**apiclient.Summoner)(nil)).Elem(),
+	"GetBySummonerName":                reflect.TypeOf((**apiclient.Summoner)(nil)).Elem(),
+	"GetBySummonerPUUID":               reflect.TypeOf((**apiclient.Summoner)(nil)).Elem(),
+	"GetRiotAccountByNameAndTag":       reflect.TypeOf((**apiclient.RiotAccount)(nil)).Elem(),
+	"GetRiotAccountByPuuid":            reflect.TypeOf((**apiclient.RiotAccount)(nil)).Elem(),
+	"GetBySummonerID":                  reflect.TypeOf((**apiclient.Summoner)(nil)).Elem(),
+	"GetThirdPartyCodeByID":            reflect.TypeOf((*string)(nil)).Elem(),
+}
+
+// GetAllChampionMasteries implements apiclient.Client.
+func (f *Fake) GetAllChampionMasteries(ctx context.Context, r region.Region, summonerID string) ([]apiclient.ChampionMastery, error) {
+	h, res, err := f.call(ctx, "GetAllChampionMasteries", r, summonerID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string) ([]apiclient.ChampionMastery, error))(ctx, r, summonerID)
+	}
+	v, _ := res.([]apiclient.ChampionMastery)
+	return v, err
+}
+
+// OnGetAllChampionMasteries answers calls to GetAllChampionMasteries with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetAllChampionMasteries(fn func(ctx context.Context, r region.Region, summonerID string) ([]apiclient.ChampionMastery, error)) {
+	f.handle("GetAllChampionMasteries", fn)
+}
+
+// GetAllChampionMasteriesByPuuid implements apiclient.Client.
+func (f *Fake) GetAllChampionMasteriesByPuuid(ctx context.Context, r region.Region, puuid string) ([]apiclient.ChampionMastery, error) {
+	h, res, err := f.call(ctx, "GetAllChampionMasteriesByPuuid", r, puuid)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, puuid string) ([]apiclient.ChampionMastery, error))(ctx, r, puuid)
+	}
+	v, _ := res.([]apiclient.ChampionMastery)
+	return v, err
+}
+
+// OnGetAllChampionMasteriesByPuuid answers calls to GetAllChampionMasteriesByPuuid with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetAllChampionMasteriesByPuuid(fn func(ctx context.Context, r region.Region, puuid string) ([]apiclient.ChampionMastery, error)) {
+	f.handle("GetAllChampionMasteriesByPuuid", fn)
+}
+
+// GetChampionMastery implements apiclient.Client.
+func (f *Fake) GetChampionMastery(ctx context.Context, r region.Region, summonerID string, champ champion.Champion) (*apiclient.ChampionMastery, error) {
+	h, res, err := f.call(ctx, "GetChampionMastery", r, summonerID, champ)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string, champ champion.Champion) (*apiclient.ChampionMastery, error))(ctx, r, summonerID, champ)
+	}
+	v, _ := res.(*apiclient.ChampionMastery)
+	return v, err
+}
+
+// OnGetChampionMastery answers calls to GetChampionMastery with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetChampionMastery(fn func(ctx context.Context, r region.Region, summonerID string, champ champion.Champion) (*apiclient.ChampionMastery, error)) {
+	f.handle("GetChampionMastery", fn)
+}
+
+// GetChampionMasteryScore implements apiclient.Client.
+func (f *Fake) GetChampionMasteryScore(ctx context.Context, r region.Region, summonerID string) (int, error) {
+	h, res, err := f.call(ctx, "GetChampionMasteryScore", r, summonerID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string) (int, error))(ctx, r, summonerID)
+	}
+	v, _ := res.(int)
+	return v, err
+}
+
+// OnGetChampionMasteryScore answers calls to GetChampionMasteryScore with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetChampionMasteryScore(fn func(ctx context.Context, r region.Region, summonerID string) (int, error)) {
+	f.handle("GetChampionMasteryScore", fn)
+}
+
+// GetChampions implements apiclient.Client.
+func (f *Fake) GetChampions(ctx context.Context, r region.Region) (*apiclient.ChampionList, error) {
+	h, res, err := f.call(ctx, "GetChampions", r)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region) (*apiclient.ChampionList, error))(ctx, r)
+	}
+	v, _ := res.(*apiclient.ChampionList)
+	return v, err
+}
+
+// OnGetChampions answers calls to GetChampions with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetChampions(fn func(ctx context.Context, r region.Region) (*apiclient.ChampionList, error)) {
+	f.handle("GetChampions", fn)
+}
+
+// GetChampionByID implements apiclient.Client.
+func (f *Fake) GetChampionByID(ctx context.Context, r region.Region, champ champion.Champion) (*apiclient.Champion, error) {
+	h, res, err := f.call(ctx, "GetChampionByID", r, champ)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, champ champion.Champion) (*apiclient.Champion, error))(ctx, r, champ)
+	}
+	v, _ := res.(*apiclient.Champion)
+	return v, err
+}
+
+// OnGetChampionByID answers calls to GetChampionByID with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetChampionByID(fn func(ctx context.Context, r region.Region, champ champion.Champion) (*apiclient.Champion, error)) {
+	f.handle("GetChampionByID", fn)
+}
+
+// GetChallengerLeague implements apiclient.Client.
+func (f *Fake) GetChallengerLeague(ctx context.Context, arg1 region.Region, arg2 queue.Queue) (*apiclient.LeagueList, error) {
+	h, res, err := f.call(ctx, "GetChallengerLeague", arg1, arg2)
+	if h != nil {
+		return h.(func(ctx context.Context, arg1 region.Region, arg2 queue.Queue) (*apiclient.LeagueList, error))(ctx, arg1, arg2)
+	}
+	v, _ := res.(*apiclient.LeagueList)
+	return v, err
+}
+
+// OnGetChallengerLeague answers calls to GetChallengerLeague with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetChallengerLeague(fn func(ctx context.Context, arg1 region.Region, arg2 queue.Queue) (*apiclient.LeagueList, error)) {
+	f.handle("GetChallengerLeague", fn)
+}
+
+// GetGrandmasterLeague implements apiclient.Client.
+func (f *Fake) GetGrandmasterLeague(ctx context.Context, r region.Region, q queue.Queue) (*apiclient.LeagueList, error) {
+	h, res, err := f.call(ctx, "GetGrandmasterLeague", r, q)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, q queue.Queue) (*apiclient.LeagueList, error))(ctx, r, q)
+	}
+	v, _ := res.(*apiclient.LeagueList)
+	return v, err
+}
+
+// OnGetGrandmasterLeague answers calls to GetGrandmasterLeague with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetGrandmasterLeague(fn func(ctx context.Context, r region.Region, q queue.Queue) (*apiclient.LeagueList, error)) {
+	f.handle("GetGrandmasterLeague", fn)
+}
+
+// GetMasterLeague implements apiclient.Client.
+func (f *Fake) GetMasterLeague(ctx context.Context, arg1 region.Region, arg2 queue.Queue) (*apiclient.LeagueList, error) {
+	h, res, err := f.call(ctx, "GetMasterLeague", arg1, arg2)
+	if h != nil {
+		return h.(func(ctx context.Context, arg1 region.Region, arg2 queue.Queue) (*apiclient.LeagueList, error))(ctx, arg1, arg2)
+	}
+	v, _ := res.(*apiclient.LeagueList)
+	return v, err
+}
+
+// OnGetMasterLeague answers calls to GetMasterLeague with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetMasterLeague(fn func(ctx context.Context, arg1 region.Region, arg2 queue.Queue) (*apiclient.LeagueList, error)) {
+	f.handle("GetMasterLeague", fn)
+}
+
+// GetAllLeaguePositionsForSummoner implements apiclient.Client.
+func (f *Fake) GetAllLeaguePositionsForSummoner(ctx context.Context, r region.Region, summonerID string) ([]apiclient.LeaguePosition, error) {
+	h, res, err := f.call(ctx, "GetAllLeaguePositionsForSummoner", r, summonerID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string) ([]apiclient.LeaguePosition, error))(ctx, r, summonerID)
+	}
+	v, _ := res.([]apiclient.LeaguePosition)
+	return v, err
+}
+
+// OnGetAllLeaguePositionsForSummoner answers calls to GetAllLeaguePositionsForSummoner with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetAllLeaguePositionsForSummoner(fn func(ctx context.Context, r region.Region, summonerID string) ([]apiclient.LeaguePosition, error)) {
+	f.handle("GetAllLeaguePositionsForSummoner", fn)
+}
+
+// GetLeagueByID implements apiclient.Client.
+func (f *Fake) GetLeagueByID(ctx context.Context, r region.Region, leagueID string) (*apiclient.LeagueList, error) {
+	h, res, err := f.call(ctx, "GetLeagueByID", r, leagueID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, leagueID string) (*apiclient.LeagueList, error))(ctx, r, leagueID)
+	}
+	v, _ := res.(*apiclient.LeagueList)
+	return v, err
+}
+
+// OnGetLeagueByID answers calls to GetLeagueByID with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetLeagueByID(fn func(ctx context.Context, r region.Region, leagueID string) (*apiclient.LeagueList, error)) {
+	f.handle("GetLeagueByID", fn)
+}
+
+// GetMatch implements apiclient.Client.
+func (f *Fake) GetMatch(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.Match, error) {
+	h, res, err := f.call(ctx, "GetMatch", r, matchID)
+	if h != nil {
+		return h.(func(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.Match, error))(ctx, r, matchID)
+	}
+	v, _ := res.(*apiclient.Match)
+	return v, err
+}
+
+// OnGetMatch answers calls to GetMatch with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetMatch(fn func(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.Match, error)) {
+	f.handle("GetMatch", fn)
+}
+
+// GetMatchTimeline implements apiclient.Client.
+func (f *Fake) GetMatchTimeline(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.MatchTimeline, error) {
+	h, res, err := f.call(ctx, "GetMatchTimeline", r, matchID)
+	if h != nil {
+		return h.(func(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.MatchTimeline, error))(ctx, r, matchID)
+	}
+	v, _ := res.(*apiclient.MatchTimeline)
+	return v, err
+}
+
+// OnGetMatchTimeline answers calls to GetMatchTimeline with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetMatchTimeline(fn func(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.MatchTimeline, error)) {
+	f.handle("GetMatchTimeline", fn)
+}
+
+// GetMatchlist implements apiclient.Client.
+func (f *Fake) GetMatchlist(ctx context.Context, r region.Region, accountID string, opts *apiclient.GetMatchlistOptions) (*apiclient.Matchlist, error) {
+	h, res, err := f.call(ctx, "GetMatchlist", r, accountID, opts)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, accountID string, opts *apiclient.GetMatchlistOptions) (*apiclient.Matchlist, error))(ctx, r, accountID, opts)
+	}
+	v, _ := res.(*apiclient.Matchlist)
+	return v, err
+}
+
+// OnGetMatchlist answers calls to GetMatchlist with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetMatchlist(fn func(ctx context.Context, r region.Region, accountID string, opts *apiclient.GetMatchlistOptions) (*apiclient.Matchlist, error)) {
+	f.handle("GetMatchlist", fn)
+}
+
+// GetMatchIds implements apiclient.Client.
+func (f *Fake) GetMatchIds(ctx context.Context, r v5region.V5Region, PUUID string, opts *apiclient.GetMatchIdsOptions) ([]string, error) {
+	h, res, err := f.call(ctx, "GetMatchIds", r, PUUID, opts)
+	if h != nil {
+		return h.(func(ctx context.Context, r v5region.V5Region, PUUID string, opts *apiclient.GetMatchIdsOptions) ([]string, error))(ctx, r, PUUID, opts)
+	}
+	v, _ := res.([]string)
+	return v, err
+}
+
+// OnGetMatchIds answers calls to GetMatchIds with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetMatchIds(fn func(ctx context.Context, r v5region.V5Region, PUUID string, opts *apiclient.GetMatchIdsOptions) ([]string, error)) {
+	f.handle("GetMatchIds", fn)
+}
+
+// GetRecentMatchlist implements apiclient.Client.
+func (f *Fake) GetRecentMatchlist(ctx context.Context, r region.Region, accountID string) (*apiclient.Matchlist, error) {
+	h, res, err := f.call(ctx, "GetRecentMatchlist", r, accountID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, accountID string) (*apiclient.Matchlist, error))(ctx, r, accountID)
+	}
+	v, _ := res.(*apiclient.Matchlist)
+	return v, err
+}
+
+// OnGetRecentMatchlist answers calls to GetRecentMatchlist with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetRecentMatchlist(fn func(ctx context.Context, r region.Region, accountID string) (*apiclient.Matchlist, error)) {
+	f.handle("GetRecentMatchlist", fn)
+}
+
+// GetFeaturedGames implements apiclient.Client.
+func (f *Fake) GetFeaturedGames(ctx context.Context, r region.Region) (*apiclient.FeaturedGames, error) {
+	h, res, err := f.call(ctx, "GetFeaturedGames", r)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region) (*apiclient.FeaturedGames, error))(ctx, r)
+	}
+	v, _ := res.(*apiclient.FeaturedGames)
+	return v, err
+}
+
+// OnGetFeaturedGames answers calls to GetFeaturedGames with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetFeaturedGames(fn func(ctx context.Context, r region.Region) (*apiclient.FeaturedGames, error)) {
+	f.handle("GetFeaturedGames", fn)
+}
+
+// GetCurrentGameInfoBySummoner implements apiclient.Client.
+func (f *Fake) GetCurrentGameInfoBySummoner(ctx context.Context, r region.Region, summonerID string) (*apiclient.CurrentGameInfo, error) {
+	h, res, err := f.call(ctx, "GetCurrentGameInfoBySummoner", r, summonerID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string) (*apiclient.CurrentGameInfo, error))(ctx, r, summonerID)
+	}
+	v, _ := res.(*apiclient.CurrentGameInfo)
+	return v, err
+}
+
+// OnGetCurrentGameInfoBySummoner answers calls to GetCurrentGameInfoBySummoner with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetCurrentGameInfoBySummoner(fn func(ctx context.Context, r region.Region, summonerID string) (*apiclient.CurrentGameInfo, error)) {
+	f.handle("GetCurrentGameInfoBySummoner", fn)
+}
+
+// GetByAccountID implements apiclient.Client.
+func (f *Fake) GetByAccountID(ctx context.Context, r region.Region, accountID string) (*apiclient.Summoner, error) {
+	h, res, err := f.call(ctx, "GetByAccountID", r, accountID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, accountID string) (*apiclient.Summoner, error))(ctx, r, accountID)
+	}
+	v, _ := res.(*apiclient.Summoner)
+	return v, err
+}
+
+// OnGetByAccountID answers calls to GetByAccountID with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetByAccountID(fn func(ctx context.Context, r region.Region, accountID string) (*apiclient.Summoner, error)) {
+	f.handle("GetByAccountID", fn)
+}
+
+// GetBySummonerName implements apiclient.Client.
+func (f *Fake) GetBySummonerName(ctx context.Context, r region.Region, name string) (*apiclient.Summoner, error) {
+	h, res, err := f.call(ctx, "GetBySummonerName", r, name)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, name string) (*apiclient.Summoner, error))(ctx, r, name)
+	}
+	v, _ := res.(*apiclient.Summoner)
+	return v, err
+}
+
+// OnGetBySummonerName answers calls to GetBySummonerName with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetBySummonerName(fn func(ctx context.Context, r region.Region, name string) (*apiclient.Summoner, error)) {
+	f.handle("GetBySummonerName", fn)
+}
+
+// GetBySummonerPUUID implements apiclient.Client.
+func (f *Fake) GetBySummonerPUUID(ctx context.Context, r region.Region, puuid string) (*apiclient.Summoner, error) {
+	h, res, err := f.call(ctx, "GetBySummonerPUUID", r, puuid)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, puuid string) (*apiclient.Summoner, error))(ctx, r, puuid)
+	}
+	v, _ := res.(*apiclient.Summoner)
+	return v, err
+}
+
+// OnGetBySummonerPUUID answers calls to GetBySummonerPUUID with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetBySummonerPUUID(fn func(ctx context.Context, r region.Region, puuid string) (*apiclient.Summoner, error)) {
+	f.handle("GetBySummonerPUUID", fn)
+}
+
+// GetRiotAccountByNameAndTag implements apiclient.Client.
+func (f *Fake) GetRiotAccountByNameAndTag(ctx context.Context, r v5region.V5Region, name string, tag string) (*apiclient.RiotAccount, error) {
+	h, res, err := f.call(ctx, "GetRiotAccountByNameAndTag", r, name, tag)
+	if h != nil {
+		return h.(func(ctx context.Context, r v5region.V5Region, name string, tag string) (*apiclient.RiotAccount, error))(ctx, r, name, tag)
+	}
+	v, _ := res.(*apiclient.RiotAccount)
+	return v, err
+}
+
+// OnGetRiotAccountByNameAndTag answers calls to GetRiotAccountByNameAndTag with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetRiotAccountByNameAndTag(fn func(ctx context.Context, r v5region.V5Region, name string, tag string) (*apiclient.RiotAccount, error)) {
+	f.handle("GetRiotAccountByNameAndTag", fn)
+}
+
+// GetRiotAccountByPuuid implements apiclient.Client.
+func (f *Fake) GetRiotAccountByPuuid(ctx context.Context, r v5region.V5Region, puuid string) (*apiclient.RiotAccount, error) {
+	h, res, err := f.call(ctx, "GetRiotAccountByPuuid", r, puuid)
+	if h != nil {
+		return h.(func(ctx context.Context, r v5region.V5Region, puuid string) (*apiclient.RiotAccount, error))(ctx, r, puuid)
+	}
+	v, _ := res.(*apiclient.RiotAccount)
+	return v, err
+}
+
+// OnGetRiotAccountByPuuid answers calls to GetRiotAccountByPuuid with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetRiotAccountByPuuid(fn func(ctx context.Context, r v5region.V5Region, puuid string) (*apiclient.RiotAccount, error)) {
+	f.handle("GetRiotAccountByPuuid", fn)
+}
+
+// GetBySummonerID implements apiclient.Client.
+func (f *Fake) GetBySummonerID(ctx context.Context, r region.Region, summonerID string) (*apiclient.Summoner, error) {
+	h, res, err := f.call(ctx, "GetBySummonerID", r, summonerID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string) (*apiclient.Summoner, error))(ctx, r, summonerID)
+	}
+	v, _ := res.(*apiclient.Summoner)
+	return v, err
+}
+
+// OnGetBySummonerID answers calls to GetBySummonerID with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetBySummonerID(fn func(ctx context.Context, r region.Region, summonerID string) (*apiclient.Summoner, error)) {
+	f.handle("GetBySummonerID", fn)
+}
+
+// GetThirdPartyCodeByID implements apiclient.Client.
+func (f *Fake) GetThirdPartyCodeByID(ctx context.Context, r region.Region, summonerID string) (string, error) {
+	h, res, err := f.call(ctx, "GetThirdPartyCodeByID", r, summonerID)
+	if h != nil {
+		return h.(func(ctx context.Context, r region.Region, summonerID string) (string, error))(ctx, r, summonerID)
+	}
+	v, _ := res.(string)
+	return v, err
+}
+
+// OnGetThirdPartyCodeByID answers calls to GetThirdPartyCodeByID with fn,
+// replacing any canned responses.
+func (f *Fake) OnGetThirdPartyCodeByID(fn func(ctx context.Context, r region.Region, summonerID string) (string, error)) {
+	f.handle("GetThirdPartyCodeByID", fn)
+}
@@ -0,0 +1,155 @@
+package apiclienttest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/tier"
+	"github.com/Tilo-K/riot/constants/v5region"
+	"github.com/Tilo-K/riot/ratelimit/ratelimittest"
+)
+
+// TestFakeCoversClient calls every method of the Client interface, to check
+// that the generated code is in sync with it.
+func TestFakeCoversClient(t *testing.T) {
+	iface := reflect.TypeOf((*apiclient.Client)(nil)).Elem()
+	if len(results) != iface.NumMethod() {
+		t.Errorf("Fake has %d generated methods, Client has %d; run go generate", len(results), iface.NumMethod())
+	}
+	f := NewFake()
+	fv := reflect.ValueOf(f)
+	for i := 0; i < iface.NumMethod(); i++ {
+		m := iface.Method(i)
+		if got, want := results[m.Name], m.Type.Out(0); got != want {
+			t.Errorf("%s: generated result type %v, want %v; run go generate", m.Name, got, want)
+			continue
+		}
+		in := []reflect.Value{reflect.ValueOf(context.Background())}
+		for j := 1; j < m.Type.NumIn(); j++ {
+			in = append(in, reflect.Zero(m.Type.In(j)))
+		}
+		call := func() (interface{}, error) {
+			out := fv.MethodByName(m.Name).Call(in)
+			err, _ := out[1].Interface().(error)
+			return out[0].Interface(), err
+		}
+
+		if _, err := call(); err != apiclient.ErrDataNotFound {
+			t.Errorf("%s: got %v without responses, want ErrDataNotFound", m.Name, err)
+		}
+		want := reflect.New(m.Type.Out(0)).Elem().Interface()
+		f.Return(m.Name, want)
+		if got, err := call(); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, %v; want %v", m.Name, got, err, want)
+		}
+		if calls := f.Calls(m.Name); len(calls) != 2 || len(calls[0].Args) != m.Type.NumIn()-1 {
+			t.Errorf("%s: recorded %+v", m.Name, calls)
+		}
+	}
+}
+
+func TestFakeResponses(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	m1 := NewMatch("NA1_1", time.Unix(1000, 0))
+	m2 := NewMatch("NA1_2", time.Unix(2000, 0))
+	errFailed := errors.New("failed")
+	f.Return("GetMatch", m1)
+	f.Fail("GetMatch", errFailed)
+	f.Return("GetMatch", m2)
+	for i, want := range []*apiclient.Match{m1, nil, m2, m2} {
+		got, err := f.GetMatch(ctx, v5region.Americas, "id")
+		if got != want || (want == nil) != (err == errFailed) {
+			t.Errorf("call %d: got %p, %v", i, got, err)
+		}
+	}
+
+	s := NewSummoner("Some Name")
+	f.OnGetBySummonerName(func(ctx context.Context, r region.Region, name string) (*apiclient.Summoner, error) {
+		if name != s.Name {
+			return nil, apiclient.ErrDataNotFound
+		}
+		return s, nil
+	})
+	if got, err := f.GetBySummonerName(ctx, region.NA1, "Some Name"); got != s || err != nil {
+		t.Errorf("GetBySummonerName() = %v, %v", got, err)
+	}
+	if _, err := f.GetBySummonerName(ctx, region.NA1, "other"); err != apiclient.ErrDataNotFound {
+		t.Errorf("GetBySummonerName() error = %v, want ErrDataNotFound", err)
+	}
+	calls := f.Calls("GetBySummonerName")
+	if len(calls) != 2 || !reflect.DeepEqual(calls[1].Args, []interface{}{region.Region(region.NA1), "other"}) {
+		t.Errorf("got calls %+v", calls)
+	}
+	if n := len(f.Calls("")); n != 6 {
+		t.Errorf("got %d calls, want 6", n)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Return() with the wrong type did not panic")
+		}
+	}()
+	f.Return("GetMatch", s)
+}
+
+func TestFakeLatency(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	f := NewFake(WithClock(clock))
+	f.SetLatency("", time.Second)
+	f.Return("GetChampionMasteryScore", 42)
+
+	done := make(chan int)
+	go func() {
+		score, _ := f.GetChampionMasteryScore(context.Background(), region.NA1, "id")
+		done <- score
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("call returned before the latency")
+	default:
+	}
+	clock.Advance(time.Second)
+	if score := <-done; score != 42 {
+		t.Errorf("got score %d, want 42", score)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.GetChampionMasteryScore(ctx, region.NA1, "id"); err != context.Canceled {
+		t.Errorf("got %v with a canceled context, want context.Canceled", err)
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	s := NewSummoner("Some Name")
+	if s.PUUID != NewSummoner("Some Name").PUUID || len(s.PUUID) != 78 {
+		t.Errorf("got PUUID %q, want a stable 78 character ID", s.PUUID)
+	}
+
+	created := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	m := NewMatch("EUW1_123", created, s.PUUID)
+	if m.Info.PlatformID != "EUW1" || m.Info.GameID != 123 || m.Info.GameCreation != created.Unix()*1000 {
+		t.Errorf("got match info %+v", m.Info)
+	}
+	if len(m.Info.Participants) != 10 || m.Info.Participants[0].Puuid != s.PUUID || !m.Info.Participants[0].Win || m.Info.Participants[5].Win {
+		t.Errorf("got participants %+v", m.Info.Participants)
+	}
+	if len(m.Metadata.Participants) != 10 || len(m.Info.Teams) != 2 {
+		t.Errorf("got %d players and %d teams", len(m.Metadata.Participants), len(m.Info.Teams))
+	}
+
+	l := NewLeagueList(tier.Challenger, queue.RankedSolo5x5, s, NewSummoner("other"))
+	if len(l.Entries) != 2 || l.Entries[0].SummonerID != s.ID || l.Entries[0].LeaguePoints <= l.Entries[1].LeaguePoints {
+		t.Errorf("got league %+v", l)
+	}
+}
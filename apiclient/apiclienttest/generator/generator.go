@@ -0,0 +1,246 @@
+// Helper binary for generating the methods of apiclienttest.Fake from the
+// apiclient.Client interface.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var (
+	src = flag.String("src", "../apiclient.go", "file declaring the Client interface")
+	out = flag.String("out", "fake_generated.go", "output file")
+)
+
+const (
+	// apiclientPath is the import path of the apiclient package, whose
+	// unqualified types are qualified in the generated code.
+	apiclientPath = "github.com/Tilo-K/riot/apiclient"
+
+	fakeFile = `// Code generated by generator.go; DO NOT EDIT.
+
+package apiclienttest
+
+import ({{range .Std}}
+	{{printf "%q" .}}{{end}}
+{{range .Imports}}
+	{{printf "%q" .}}{{end}}
+)
+
+// results holds the result type of each method, which canned responses must
+// be assignable to.
+var results = map[string]reflect.Type{ {{range .Methods}}
+	{{printf "%q" .Name}}: reflect.TypeOf((*{{.Result}})(nil)).Elem(),{{end}}
+}
+{{range .Methods}}
+// {{.Name}} implements apiclient.Client.
+func (f *Fake) {{.Name}}({{.Params}}) ({{.Result}}, error) {
+	h, res, err := f.call(ctx, {{printf "%q" .Name}}{{range .Args}}, {{.}}{{end}})
+	if h != nil {
+		return h.(func({{.Params}}) ({{.Result}}, error))(ctx{{range .Args}}, {{.}}{{end}})
+	}
+	v, _ := res.({{.Result}})
+	return v, err
+}
+
+// On{{.Name}} answers calls to {{.Name}} with fn,
+// replacing any canned responses.
+func (f *Fake) On{{.Name}}(fn func({{.Params}}) ({{.Result}}, error)) {
+	f.handle({{printf "%q" .Name}}, fn)
+}
+{{end}}`
+)
+
+// reserved are the names used by the generated code, which are not used for
+// parameters.
+var reserved = map[string]bool{"ctx": true, "f": true, "h": true, "res": true, "err": true, "v": true}
+
+// method is a method of the Client interface.
+type method struct {
+	Name string
+
+	// Params is the parameter list, in which the context is named ctx.
+	Params string
+
+	// Args are the names of the parameters after the context.
+	Args []string
+
+	// Result is the type of the first result.
+	Result string
+}
+
+// generator converts the methods of the interface.
+type generator struct {
+	fset *token.FileSet
+
+	// imports maps the package names of the source file to import paths, and
+	// used holds those referenced by the methods.
+	imports map[string]string
+	used    map[string]bool
+}
+
+// qualify returns the type expression with the unqualified exported types of
+// the source package qualified by the package name.
+func (g *generator) qualify(e ast.Expr) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if t.IsExported() {
+			g.used["apiclient"] = true
+			return &ast.SelectorExpr{X: ast.NewIdent("apiclient"), Sel: ast.NewIdent(t.Name)}
+		}
+		return ast.NewIdent(t.Name)
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if !ok {
+			log.Fatalf("unsupported type %s", g.expr(t))
+		}
+		g.used[pkg.Name] = true
+		return &ast.SelectorExpr{X: ast.NewIdent(pkg.Name), Sel: ast.NewIdent(t.Sel.Name)}
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: g.qualify(t.X)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: t.Len, Elt: g.qualify(t.Elt)}
+	case *ast.MapType:
+		return &ast.MapType{Key: g.qualify(t.Key), Value: g.qualify(t.Value)}
+	}
+	log.Fatalf("unsupported type %T", e)
+	return nil
+}
+
+func (g *generator) expr(e ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, g.fset, e); err != nil {
+		log.Fatal(err)
+	}
+	return buf.String()
+}
+
+// method converts a method declared in the interface.
+func (g *generator) method(name string, f *ast.FuncType) method {
+	m := method{Name: name}
+	var params []string
+	i := 0
+	for _, p := range f.Params.List {
+		typ := g.expr(g.qualify(p.Type))
+		names := p.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		for _, n := range names {
+			var arg string
+			switch {
+			case i == 0:
+				if typ != "context.Context" {
+					log.Fatalf("%s: the first parameter is not a context", name)
+				}
+				arg = "ctx"
+			case n == nil || reserved[n.Name]:
+				arg = "arg" + strconv.Itoa(i)
+			default:
+				arg = n.Name
+			}
+			if i > 0 {
+				m.Args = append(m.Args, arg)
+			}
+			params = append(params, arg+" "+typ)
+			i++
+		}
+	}
+	m.Params = strings.Join(params, ", ")
+	if f.Results == nil || len(f.Results.List) != 2 || g.expr(f.Results.List[1].Type) != "error" {
+		log.Fatalf("%s: the results are not a value and an error", name)
+	}
+	m.Result = g.expr(g.qualify(f.Results.List[0].Type))
+	return m
+}
+
+func main() {
+	flag.Parse()
+	g := &generator{
+		fset:    token.NewFileSet(),
+		imports: map[string]string{"apiclient": apiclientPath},
+		used:    make(map[string]bool),
+	}
+	file, err := parser.ParseFile(g.fset, *src, nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		g.imports[name] = path
+	}
+
+	var methods []method
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || spec.Name.Name != "Client" {
+			return true
+		}
+		iface, ok := spec.Type.(*ast.InterfaceType)
+		if !ok {
+			log.Fatal("Client is not an interface")
+		}
+		for _, field := range iface.Methods.List {
+			f, ok := field.Type.(*ast.FuncType)
+			if !ok {
+				log.Fatal("embedded interfaces are not supported")
+			}
+			methods = append(methods, g.method(field.Names[0].Name, f))
+		}
+		return false
+	})
+	if len(methods) == 0 {
+		log.Fatalf("no Client interface in %s", *src)
+	}
+
+	// Standard library imports are grouped before the others, as in the rest
+	// of the repository.
+	std := []string{"reflect"}
+	var imports []string
+	for name := range g.used {
+		path, ok := g.imports[name]
+		switch {
+		case !ok:
+			log.Fatalf("unknown package %s", name)
+		case strings.Contains(strings.SplitN(path, "/", 2)[0], "."):
+			imports = append(imports, path)
+		default:
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(imports)
+
+	var buf bytes.Buffer
+	t := template.Must(template.New("fake").Parse(fakeFile))
+	if err := t.Execute(&buf, struct {
+		Std     []string
+		Imports []string
+		Methods []method
+	}{std, imports, methods}); err != nil {
+		log.Fatal(err)
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(fmt.Errorf("formatting generated code: %v", err))
+	}
+	if err := ioutil.WriteFile(*out, b, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,6 +1,11 @@
 package apiclient
 
-import "errors"
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
 
 var (
 	ErrBadRequest           = errors.New("bad request")
@@ -17,6 +22,18 @@ var (
 
 	ErrBadHTTPStatus = errors.New("bad HTTP status returned by server")
 
+	// ErrServiceRateLimitExceeded is returned instead of ErrRateLimitExceeded
+	// when the rate limit was enforced by the underlying Riot service, rather
+	// than by the application or method limits of the key. It wraps
+	// ErrRateLimitExceeded, so errors.Is(err, ErrRateLimitExceeded) reports
+	// both kinds of rate limit.
+	ErrServiceRateLimitExceeded error = &wrappedError{"service rate limit exceeded", ErrRateLimitExceeded}
+
+	// ErrKeyMismatch is returned instead of ErrBadRequest when the API could
+	// not decrypt a summoner or account ID, which typically means that the ID
+	// was issued for another API key.
+	ErrKeyMismatch = errors.New("encrypted ID was issued for another key")
+
 	httpErrors = map[int]error{
 		400: ErrBadRequest,
 		401: ErrUnauthorized,
@@ -31,3 +48,38 @@ var (
 		504: ErrGatewayTimeout,
 	}
 )
+
+// wrappedError is a more specific variant of another error.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string { return e.msg }
+func (e *wrappedError) Unwrap() error { return e.err }
+
+// errorForResponse returns the error corresponding to the HTTP status of the
+// response. The body of a bad request response is inspected for decryption
+// failures, and left to be read from the beginning.
+func errorForResponse(res *http.Response) error {
+	if res.StatusCode == http.StatusBadRequest && res.Body != nil {
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if err == nil && bytes.Contains(b, []byte("Exception decrypting")) {
+			return ErrKeyMismatch
+		}
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		switch res.Header.Get("X-Rate-Limit-Type") {
+		case "application", "method":
+		default:
+			return ErrServiceRateLimitExceeded
+		}
+	}
+	err, ok := httpErrors[res.StatusCode]
+	if !ok {
+		err = ErrBadHTTPStatus
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package apiclient
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRateLimitErrors(t *testing.T) {
+	for _, test := range []struct {
+		limitType   string
+		want        error
+		wantService bool
+	}{
+		{"application", ErrRateLimitExceeded, false},
+		{"method", ErrRateLimitExceeded, false},
+		{"service", ErrServiceRateLimitExceeded, true},
+		{"", ErrServiceRateLimitExceeded, true},
+	} {
+		res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if test.limitType != "" {
+			res.Header.Set("X-Rate-Limit-Type", test.limitType)
+		}
+		err := errorForResponse(res)
+		if err != test.want {
+			t.Errorf("%q: got %v, want %v", test.limitType, err, test.want)
+		}
+		if !errors.Is(err, ErrRateLimitExceeded) {
+			t.Errorf("%q: got %v, want it to match ErrRateLimitExceeded", test.limitType, err)
+		}
+		if got := errors.Is(err, ErrServiceRateLimitExceeded); got != test.wantService {
+			t.Errorf("%q: got match ErrServiceRateLimitExceeded %v, want %v", test.limitType, got, test.wantService)
+		}
+	}
+}
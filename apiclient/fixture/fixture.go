@@ -0,0 +1,207 @@
+// Package fixture records and replays HTTP exchanges with the Riot API, so
+// that code built on apiclient can be tested without a key or network access.
+//
+// Use NewRecorder() to wrap a real HTTP client while running against the live
+// API, and NewReplayer() to serve the recorded responses in tests. Responses
+// keep their rate limit headers, so a ratelimit.Limiter behaves as it would
+// against the live API.
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Tilo-K/riot/external"
+)
+
+var (
+	// ErrNotRecorded is returned by a replayer for a request that has no
+	// recorded response.
+	ErrNotRecorded = errors.New("no recorded response")
+
+	// unsafeChars are replaced in fixture file names.
+	unsafeChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+)
+
+// scrubbedParams are URL parameters that carry credentials, and are removed
+// before requests are recorded or matched.
+var scrubbedParams = []string{"api_key"}
+
+// scrubbedHeaders are response headers that are not recorded.
+var scrubbedHeaders = []string{"Set-Cookie", "Date"}
+
+// response is a recorded HTTP response.
+type response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// fixture holds the responses recorded for a request, in order.
+type fixture struct {
+	Method    string     `json:"method"`
+	URL       string     `json:"url"`
+	Responses []response `json:"responses"`
+}
+
+// requestKey returns the method and URL that identify the request, without
+// credentials and with the query parameters in a stable order.
+func requestKey(req *http.Request) (method, url string) {
+	u := *req.URL
+	q := u.Query()
+	for _, p := range scrubbedParams {
+		q.Del(p)
+	}
+	u.RawQuery = q.Encode()
+	u.Fragment = ""
+	return req.Method, u.String()
+}
+
+// fileName returns the name of the fixture file for the request. It is
+// readable, and a hash keeps it unique.
+func fileName(method, url string) string {
+	sum := sha256.Sum256([]byte(method + " " + url))
+	readable := unsafeChars.ReplaceAllString(strings.TrimPrefix(url, "https://"), "_")
+	if len(readable) > 100 {
+		readable = readable[:100]
+	}
+	return fmt.Sprintf("%s_%s_%s.json", method, readable, hex.EncodeToString(sum[:6]))
+}
+
+type recorder struct {
+	d   external.Doer
+	dir string
+
+	lock     sync.Mutex
+	fixtures map[string]*fixture
+}
+
+func (r *recorder) Do(req *http.Request) (*http.Response, error) {
+	res, err := r.d.Do(req)
+	if err != nil {
+		return res, err
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return res, err
+	}
+
+	header := res.Header.Clone()
+	for _, h := range scrubbedHeaders {
+		header.Del(h)
+	}
+	method, url := requestKey(req)
+	name := fileName(method, url)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	f, ok := r.fixtures[name]
+	if !ok {
+		f = &fixture{Method: method, URL: url}
+		r.fixtures[name] = f
+	}
+	f.Responses = append(f.Responses, response{
+		StatusCode: res.StatusCode,
+		Header:     header,
+		Body:       string(b),
+	})
+	js, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return res, err
+	}
+	return res, ioutil.WriteFile(filepath.Join(r.dir, name), js, 0644)
+}
+
+// NewRecorder returns a Doer that sends requests with the given Doer, and
+// writes each request and response to a file in dir. Repeated requests are
+// recorded in order in the same file, replacing any file from an earlier
+// recording. Request headers, including X-Riot-Token, and the api_key URL
+// parameter are not recorded.
+func NewRecorder(d external.Doer, dir string) (external.Doer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &recorder{
+		d:        d,
+		dir:      dir,
+		fixtures: make(map[string]*fixture),
+	}, nil
+}
+
+type replayer struct {
+	fixtures map[string]*fixture
+
+	// lock protects next, the index of the next response for each fixture.
+	lock sync.Mutex
+	next map[string]int
+}
+
+func (r *replayer) Do(req *http.Request) (*http.Response, error) {
+	method, url := requestKey(req)
+	name := fileName(method, url)
+	f, ok := r.fixtures[name]
+	if !ok || len(f.Responses) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, method, url)
+	}
+
+	r.lock.Lock()
+	i := r.next[name]
+	if i < len(f.Responses)-1 {
+		r.next[name]++
+	}
+	r.lock.Unlock()
+
+	rec := f.Responses[i]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Header.Clone(),
+		Body:          ioutil.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
+
+// NewReplayer returns a Doer that answers requests with the responses recorded
+// in dir by NewRecorder(). Responses to a repeated request are returned in the
+// order they were recorded, and the last one is returned once all have been
+// used. Requests that were not recorded fail with ErrNotRecorded. The returned
+// Doer is threadsafe.
+func NewReplayer(dir string) (external.Doer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	r := &replayer{
+		fixtures: make(map[string]*fixture),
+		next:     make(map[string]int),
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f fixture
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		r.fixtures[fileName(f.Method, f.URL)] = &f
+	}
+	return r, nil
+}
@@ -0,0 +1,135 @@
+package fixture
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/ratelimittest"
+)
+
+const key = "RGAPI-secret"
+
+// upstream answers with a summoner named after the request path, and with
+// rate limit headers from the simulated server.
+type upstream struct {
+	s *ratelimittest.Server
+}
+
+func (u upstream) Do(req *http.Request) (*http.Response, error) {
+	res := u.s.Call(req.URL.Path)
+	name := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	res.Body = ioutil.NopCloser(strings.NewReader(`{"name":"` + name + `"}`))
+	res.Request = req
+	return res, nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := ratelimittest.NewServer(ratelimittest.NewFakeClock(time.Unix(0, 0)), "100:1", "50:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := NewRecorder(upstream{s}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := apiclient.New(key, rec, ratelimit.NewLimiter())
+	for _, name := range []string{"a", "b", "a"} {
+		if _, err := c.GetBySummonerName(ctx, region.NA1, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got %d fixture files, want 2", len(paths))
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), key) {
+			t.Errorf("%s: the API key was recorded", path)
+		}
+		if !strings.Contains(string(b), "X-Method-Rate-Limit-Count") {
+			t.Errorf("%s: rate limit headers were not recorded", path)
+		}
+	}
+
+	rep, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = apiclient.New("another-key", rep, ratelimit.NewLimiter())
+	for _, name := range []string{"a", "b", "a", "a"} {
+		got, err := c.GetBySummonerName(ctx, region.NA1, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != name {
+			t.Errorf("got summoner %q, want %q", got.Name, name)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "https://na1.api.riotgames.com/missing", nil)
+	if _, err := rep.Do(req); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("got %v for a missing fixture, want ErrNotRecorded", err)
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, err := ratelimittest.NewServer(ratelimittest.NewFakeClock(time.Unix(0, 0)), "", "1:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := NewRecorder(upstream{s}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://na1.api.riotgames.com/lol/summoner/v4/summoners/by-name/a?api_key=" + key
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", url, nil)
+		if _, err := rec.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second call exceeded the method limit, and is replayed with its
+	// Retry-After header, then repeated.
+	rep, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("GET", strings.TrimSuffix(url, key)+"other", nil)
+		res, err := rep.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != want {
+			t.Errorf("response %d: got status %d, want %d", i, res.StatusCode, want)
+		}
+		if want == http.StatusTooManyRequests && res.Header.Get("Retry-After") == "" {
+			t.Errorf("response %d: got no Retry-After header", i)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		if !strings.Contains(string(b), `"name":"a"`) {
+			t.Errorf("response %d: got body %s", i, b)
+		}
+	}
+}
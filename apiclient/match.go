@@ -1525,19 +1525,57 @@ type GetMatchlistOptions struct {
 	EndIndex   *int                `json:"endIndex"`
 }
 
+// GetMatchIdsOptions filters and pages the match IDs returned by GetMatchIds.
+// Zero values are not sent.
 type GetMatchIdsOptions struct {
-	StartTime int64  `json:"beginTime"`
-	EndTime   int64  `json:"endTime"`
-	Queue     int    `json:"queue"`
-	Type      string `json:"type"`
-	Start     int    `json:"start"`
-	Count     int    `json:"count"`
+	// StartTime and EndTime bound the start time of matches. Match-v5 has
+	// match timestamps for matches since June 16th, 2021.
+	StartTime time.Time   `json:"startTime"`
+	EndTime   time.Time   `json:"endTime"`
+	Queue     queue.Queue `json:"queue"`
+
+	// Type is the type of match, such as "ranked", "normal", "tourney" or
+	// "tutorial".
+	Type string `json:"type"`
+
+	// Start is the index of the first ID to return, and Count the number of
+	// IDs to return, 20 by default and at most MaxMatchIdsCount.
+	Start int `json:"start"`
+	Count int `json:"count"`
 }
 
+// MaxMatchIdsCount is the maximum number of IDs returned by a call to
+// GetMatchIds.
+const MaxMatchIdsCount = 100
+
 func timeToUnixMilliseconds(t time.Time) int64 {
 	return t.UnixNano() / int64(time.Millisecond/time.Nanosecond)
 }
 
+// values returns the query parameters for the options.
+func (opts *GetMatchIdsOptions) values() url.Values {
+	vals := url.Values(make(map[string][]string))
+	if !opts.StartTime.IsZero() {
+		vals.Add("startTime", fmt.Sprintf("%d", opts.StartTime.Unix()))
+	}
+	if !opts.EndTime.IsZero() {
+		vals.Add("endTime", fmt.Sprintf("%d", opts.EndTime.Unix()))
+	}
+	if opts.Queue != 0 {
+		vals.Add("queue", fmt.Sprintf("%d", opts.Queue))
+	}
+	if opts.Type != "" {
+		vals.Add("type", opts.Type)
+	}
+	if opts.Start != 0 {
+		vals.Add("start", fmt.Sprintf("%d", opts.Start))
+	}
+	if opts.Count != 0 {
+		vals.Add("count", fmt.Sprintf("%d", opts.Count))
+	}
+	return vals
+}
+
 func (c *client) GetMatchIds(ctx context.Context, r v5region.V5Region, PUUID string, opts *GetMatchIdsOptions) ([]string, error) {
 	var (
 		res  []string
@@ -1545,22 +1583,7 @@ func (c *client) GetMatchIds(ctx context.Context, r v5region.V5Region, PUUID str
 	)
 
 	if opts != nil {
-		vals = url.Values(make(map[string][]string))
-		if opts.Queue != 0 {
-			vals.Add("queue", fmt.Sprintf("%d", opts.Queue))
-		}
-		if opts.StartTime != 0 {
-			vals.Add("startTime", fmt.Sprintf("%d", opts.StartTime))
-		}
-		if opts.EndTime != 0 {
-			vals.Add("endTime", fmt.Sprintf("%d", opts.EndTime))
-		}
-		if opts.Start != 0 {
-			vals.Add("beginIndex", fmt.Sprintf("%d", opts.Start))
-		}
-		if opts.Count != 0 {
-			vals.Add("count", fmt.Sprintf("%d", opts.Count))
-		}
+		vals = opts.values()
 	}
 	_, err := c.dispatchAndUnmarshalV5(ctx, r, "/lol/match/v5/matches/by-puuid", fmt.Sprintf("/%s/ids", PUUID), vals, &res)
 	return res, err
@@ -0,0 +1,130 @@
+package apiclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+// DefaultBatchConcurrency is the number of concurrent calls made by
+// GetMatches and GetMatchTimelines by default.
+const DefaultBatchConcurrency = 10
+
+// BatchOptions configures GetMatches and GetMatchTimelines.
+type BatchOptions struct {
+	// Concurrency is the maximum number of concurrent calls, or
+	// DefaultBatchConcurrency if zero. The rate limiter of the client paces
+	// the calls.
+	Concurrency int
+}
+
+// MatchResult is the result of fetching a match by ID.
+type MatchResult struct {
+	ID    string
+	Match *Match
+	Err   error
+}
+
+// MatchTimelineResult is the result of fetching a match timeline by ID.
+type MatchTimelineResult struct {
+	ID       string
+	Timeline *MatchTimeline
+	Err      error
+}
+
+// batch calls fetch for each ID with bounded concurrency, and then calls done.
+// Once the context is done, skip is called with the context error for each ID
+// that was not fetched instead. fetch and skip must return once the context is
+// done, so that done is always called.
+func batch(ctx context.Context, ids []string, opts *BatchOptions, fetch func(id string), skip func(id string, err error), done func()) {
+	workers := DefaultBatchConcurrency
+	if opts != nil && opts.Concurrency > 0 {
+		workers = opts.Concurrency
+	}
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range next {
+				if err := ctx.Err(); err != nil {
+					skip(id, err)
+					continue
+				}
+				fetch(id)
+			}
+		}()
+	}
+	go func() {
+		defer func() {
+			close(next)
+			wg.Wait()
+			done()
+		}()
+		for i, id := range ids {
+			select {
+			case next <- id:
+			case <-ctx.Done():
+				for _, id := range ids[i:] {
+					skip(id, ctx.Err())
+				}
+				return
+			}
+		}
+	}()
+}
+
+// GetMatches fetches the matches with the given IDs concurrently, and sends
+// the result for each ID on the returned channel as it arrives. Each ID gets
+// one result, after which the channel is closed.
+//
+// Once the context is done, no more matches are fetched, and the remaining IDs
+// are reported with the context error on a best-effort basis: the goroutines
+// no longer wait for the caller, so results may be dropped, and callers may
+// stop receiving after cancelling the context. The channel is closed once the
+// calls in progress have returned.
+func GetMatches(ctx context.Context, c Client, r v5region.V5Region, ids []string, opts *BatchOptions) <-chan MatchResult {
+	out := make(chan MatchResult)
+	send := func(res MatchResult) {
+		select {
+		case out <- res:
+		case <-ctx.Done():
+		}
+	}
+	batch(ctx, ids, opts, func(id string) {
+		m, err := c.GetMatch(ctx, r, id)
+		send(MatchResult{ID: id, Match: m, Err: err})
+	}, func(id string, err error) {
+		send(MatchResult{ID: id, Err: err})
+	}, func() {
+		close(out)
+	})
+	return out
+}
+
+// GetMatchTimelines fetches the match timelines with the given IDs in the
+// same way as GetMatches.
+func GetMatchTimelines(ctx context.Context, c Client, r v5region.V5Region, ids []string, opts *BatchOptions) <-chan MatchTimelineResult {
+	out := make(chan MatchTimelineResult)
+	send := func(res MatchTimelineResult) {
+		select {
+		case out <- res:
+		case <-ctx.Done():
+		}
+	}
+	batch(ctx, ids, opts, func(id string) {
+		t, err := c.GetMatchTimeline(ctx, r, id)
+		send(MatchTimelineResult{ID: id, Timeline: t, Err: err})
+	}, func(id string, err error) {
+		send(MatchTimelineResult{ID: id, Err: err})
+	}, func() {
+		close(out)
+	})
+	return out
+}
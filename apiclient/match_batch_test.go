@@ -0,0 +1,139 @@
+package apiclient_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/apiclient/apiclienttest"
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+func TestGetMatches(t *testing.T) {
+	var (
+		lock           sync.Mutex
+		active, maxAct int
+	)
+	f := apiclienttest.NewFake()
+	f.OnGetMatch(func(ctx context.Context, r v5region.V5Region, id string) (*apiclient.Match, error) {
+		lock.Lock()
+		active++
+		if active > maxAct {
+			maxAct = active
+		}
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+		lock.Lock()
+		active--
+		lock.Unlock()
+		if id == "NA1_13" {
+			return nil, apiclient.ErrDataNotFound
+		}
+		return apiclienttest.NewMatch(id, time.Unix(0, 0)), nil
+	})
+
+	var ids []string
+	for i := 0; i < 50; i++ {
+		ids = append(ids, fmt.Sprintf("NA1_%d", i))
+	}
+	got := make(map[string]bool)
+	for res := range apiclient.GetMatches(context.Background(), f, v5region.Americas, ids, &apiclient.BatchOptions{Concurrency: 5}) {
+		switch {
+		case res.ID == "NA1_13":
+			if res.Err != apiclient.ErrDataNotFound {
+				t.Errorf("%s: got error %v, want ErrDataNotFound", res.ID, res.Err)
+			}
+		case res.Err != nil || res.Match.Metadata.MatchID != res.ID:
+			t.Errorf("%s: got %v, %v", res.ID, res.Match, res.Err)
+		}
+		got[res.ID] = true
+	}
+	if len(got) != len(ids) {
+		t.Errorf("got %d results, want %d", len(got), len(ids))
+	}
+	if maxAct > 5 {
+		t.Errorf("got %d concurrent calls, want at most 5", maxAct)
+	}
+}
+
+// blockingTimelines returns a fake that returns the timeline of NA1_0, and
+// blocks on all other IDs until the context is done.
+func blockingTimelines() *apiclienttest.Fake {
+	f := apiclienttest.NewFake()
+	f.OnGetMatchTimeline(func(ctx context.Context, r v5region.V5Region, id string) (*apiclient.MatchTimeline, error) {
+		if id == "NA1_0" {
+			return &apiclient.MatchTimeline{}, nil
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	return f
+}
+
+// waitForGoroutines fails the test if the number of goroutines does not drop
+// back to the given number.
+func waitForGoroutines(t *testing.T, want int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > want; {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d goroutines after canceling, want %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetMatchTimelinesCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	f := blockingTimelines()
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("NA1_%d", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := apiclient.GetMatchTimelines(ctx, f, v5region.Americas, ids, nil)
+	if res := <-results; res.ID != "NA1_0" || res.Err != nil {
+		t.Errorf("got %+v, want the first timeline", res)
+	}
+	// Keep receiving after canceling. No ID is reported twice.
+	cancel()
+	got := map[string]int{"NA1_0": 1}
+	for res := range results {
+		got[res.ID]++
+		if res.Err != context.Canceled {
+			t.Errorf("%s: got error %v, want context.Canceled", res.ID, res.Err)
+		}
+	}
+	for id, n := range got {
+		if n != 1 {
+			t.Errorf("%s: got %d results, want 1", id, n)
+		}
+	}
+	waitForGoroutines(t, before)
+	if n := len(f.Calls("GetMatchTimeline")); n > apiclient.DefaultBatchConcurrency+1 {
+		t.Errorf("got %d calls, want at most %d", n, apiclient.DefaultBatchConcurrency+1)
+	}
+}
+
+func TestGetMatchTimelinesCancelWithoutReceiving(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("NA1_%d", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := apiclient.GetMatchTimelines(ctx, blockingTimelines(), v5region.Americas, ids, nil)
+	if res := <-results; res.ID != "NA1_0" || res.Err != nil {
+		t.Errorf("got %+v, want the first timeline", res)
+	}
+	// Stop receiving and cancel. All goroutines exit, and the channel closes.
+	cancel()
+	waitForGoroutines(t, before)
+	for range results {
+	}
+}
@@ -0,0 +1,103 @@
+package apiclient
+
+import (
+	"context"
+
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+// MatchIdsIterator pages through the match IDs of a player with GetMatchIds,
+// most recent first. Call Next until it returns false, then check Err:
+//
+//	it := apiclient.NewMatchIdsIterator(c, v5region.Europe, puuid, nil)
+//	for it.Next(ctx) {
+//		id := it.ID()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// A MatchIdsIterator is not threadsafe.
+type MatchIdsIterator struct {
+	c     Client
+	r     v5region.V5Region
+	puuid string
+	opts  GetMatchIdsOptions
+
+	page []string
+	id   string
+	done bool
+	err  error
+
+	// seen holds the IDs returned so far. Matches played while iterating
+	// shift the pages, which would otherwise return IDs twice.
+	seen map[string]bool
+}
+
+// NewMatchIdsIterator returns an iterator over the match IDs of the player
+// with the given PUUID, filtered by the options, if any. Iteration begins at
+// opts.Start, and opts.Count sets the number of IDs requested per call, which
+// defaults to MaxMatchIdsCount.
+func NewMatchIdsIterator(c Client, r v5region.V5Region, puuid string, opts *GetMatchIdsOptions) *MatchIdsIterator {
+	it := &MatchIdsIterator{c: c, r: r, puuid: puuid, seen: make(map[string]bool)}
+	if opts != nil {
+		it.opts = *opts
+	}
+	if it.opts.Count <= 0 || it.opts.Count > MaxMatchIdsCount {
+		it.opts.Count = MaxMatchIdsCount
+	}
+	return it
+}
+
+// Next advances to the next match ID, fetching the next page if needed. It
+// returns false at the end of the history, or if fetching a page failed.
+func (it *MatchIdsIterator) Next(ctx context.Context) bool {
+	for {
+		for len(it.page) > 0 {
+			id := it.page[0]
+			it.page = it.page[1:]
+			if !it.seen[id] {
+				it.seen[id] = true
+				it.id = id
+				return true
+			}
+		}
+		if it.done || it.err != nil {
+			it.id = ""
+			return false
+		}
+		opts := it.opts
+		page, err := it.c.GetMatchIds(ctx, it.r, it.puuid, &opts)
+		if err != nil {
+			it.err = err
+			continue
+		}
+		// A short page is the last one.
+		it.done = len(page) < it.opts.Count
+		it.opts.Start += len(page)
+		it.page = page
+	}
+}
+
+// ID returns the current match ID.
+func (it *MatchIdsIterator) ID() string {
+	return it.id
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *MatchIdsIterator) Err() error {
+	return it.err
+}
+
+// GetAllMatchIds returns the IDs of all matches of the player with the given
+// PUUID that match the options, most recent first, by paging through them
+// with a MatchIdsIterator.
+func GetAllMatchIds(ctx context.Context, c Client, r v5region.V5Region, puuid string, opts *GetMatchIdsOptions) ([]string, error) {
+	var ids []string
+	it := NewMatchIdsIterator(c, r, puuid, opts)
+	for it.Next(ctx) {
+		ids = append(ids, it.ID())
+	}
+	return ids, it.Err()
+}
@@ -0,0 +1,445 @@
+package apiclient
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Tilo-K/riot/constants/champion"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
+	"github.com/Tilo-K/riot/external"
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+// ErrNoKeys is returned by a pool client that was constructed without keys.
+var ErrNoKeys = errors.New("no API keys configured")
+
+// MaxPoolPins is the number of encrypted IDs for which a pool remembers the
+// issuing key.
+const MaxPoolPins = 100000
+
+// pin is the issuing key of an encrypted ID.
+type pin struct {
+	id string
+	i  int
+}
+
+// pool is the Client implementation returned by NewPool.
+type pool struct {
+	clients []*client
+	limiter ratelimit.Limiter
+
+	// next breaks ties between keys with equal remaining quota, so that calls
+	// are spread round robin until the limits are known.
+	next uint32
+
+	// pins maps encrypted summoner and account IDs to the element of pinLRU
+	// holding the index of the key that issued them. pinLRU is ordered from
+	// most to least recently used, and holds at most maxPins elements.
+	pinsLock sync.Mutex
+	pins     map[string]*list.Element
+	pinLRU   *list.List
+	maxPins  int
+}
+
+// NewPool returns a Client that spreads calls across several API keys. The
+// returned Client is threadsafe.
+//
+// Calls that identify players by PUUID, or do not identify a player at all,
+// are sent using the key with the most remaining application quota in the
+// region, as reported by the limiter if it implements ratelimit.QuotaReporter.
+// Otherwise, keys are used round robin.
+//
+// Summoner and account IDs are encrypted per key, so calls that take one are
+// sent using the key that issued the ID. The pool learns the issuing key from
+// the summoners, league entries and spectator participants it returns. Calls
+// with IDs obtained elsewhere try each key until one is able to decrypt the ID,
+// and stop at the first other error.
+// The pool remembers the issuing keys of the MaxPoolPins most recently used
+// IDs, which takes up to about 20 MB.
+func NewPool(keys []string, httpClient external.Doer, limiter ratelimit.Limiter) Client {
+	p := &pool{
+		limiter: limiter,
+		pins:    make(map[string]*list.Element),
+		pinLRU:  list.New(),
+		maxPins: MaxPoolPins,
+	}
+	for _, key := range keys {
+		p.clients = append(p.clients, &client{
+			key: key,
+			c:   httpClient,
+			r:   limiter,
+		})
+	}
+	return p
+}
+
+// order returns the key indices for the region, from most to least remaining
+// quota. Keys with unknown limits are preferred, since they are likely unused.
+func (p *pool) order(r string) []int {
+	n := len(p.clients)
+	start := int(atomic.AddUint32(&p.next, 1)) % n
+	res := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, (start+i)%n)
+	}
+
+	q, ok := p.limiter.(ratelimit.QuotaReporter)
+	if !ok {
+		return res
+	}
+	r = strings.ToUpper(r)
+	quota := make([]int64, n)
+	for i, c := range p.clients {
+		quota[i] = q.Available(ratelimit.Invocation{ApplicationKey: c.key, Region: r})
+	}
+	better := func(a, b int64) bool {
+		if a < 0 {
+			return b >= 0
+		}
+		return b >= 0 && a > b
+	}
+	// Insertion sort keeps the round robin order among equal keys.
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && better(quota[res[j]], quota[res[j-1]]); j-- {
+			res[j], res[j-1] = res[j-1], res[j]
+		}
+	}
+	return res
+}
+
+// pin records that the ID was issued by the key with the given index, and
+// forgets the least recently used ID if there are too many.
+func (p *pool) pin(id string, i int) {
+	if id == "" {
+		return
+	}
+	p.pinsLock.Lock()
+	defer p.pinsLock.Unlock()
+	if e, ok := p.pins[id]; ok {
+		e.Value.(*pin).i = i
+		p.pinLRU.MoveToFront(e)
+		return
+	}
+	p.pins[id] = p.pinLRU.PushFront(&pin{id: id, i: i})
+	if p.pinLRU.Len() > p.maxPins {
+		e := p.pinLRU.Back()
+		p.pinLRU.Remove(e)
+		delete(p.pins, e.Value.(*pin).id)
+	}
+}
+
+// pinned returns the index of the key that issued the ID.
+func (p *pool) pinned(id string) (int, bool) {
+	p.pinsLock.Lock()
+	defer p.pinsLock.Unlock()
+	e, ok := p.pins[id]
+	if !ok {
+		return 0, false
+	}
+	p.pinLRU.MoveToFront(e)
+	return e.Value.(*pin).i, true
+}
+
+// anyKey calls f with the key that has the most remaining quota in the
+// region.
+func (p *pool) anyKey(r string, f func(i int, c *client) error) error {
+	if len(p.clients) == 0 {
+		return ErrNoKeys
+	}
+	i := p.order(r)[0]
+	return f(i, p.clients[i])
+}
+
+// byID calls f with the key that issued the encrypted ID. If the key is not
+// known, then each key is tried in order of remaining quota while the API
+// fails with ErrKeyMismatch.
+func (p *pool) byID(r string, id string, f func(i int, c *client) error) error {
+	if len(p.clients) == 0 {
+		return ErrNoKeys
+	}
+	if i, ok := p.pinned(id); ok {
+		return f(i, p.clients[i])
+	}
+	var err error
+	for _, i := range p.order(r) {
+		err = f(i, p.clients[i])
+		if err == ErrKeyMismatch {
+			continue
+		}
+		if err == nil {
+			p.pin(id, i)
+		}
+		return err
+	}
+	return err
+}
+
+// pinSummoner records the IDs of a summoner returned with the given key.
+func (p *pool) pinSummoner(s *Summoner, i int) {
+	if s != nil {
+		p.pin(s.ID, i)
+		p.pin(s.AccountID, i)
+	}
+}
+
+// pinLeague records the summoner IDs of league entries returned with the given
+// key.
+func (p *pool) pinLeague(l *LeagueList, i int) {
+	if l != nil {
+		for _, e := range l.Entries {
+			p.pin(e.SummonerID, i)
+		}
+	}
+}
+
+func (p *pool) GetAllChampionMasteries(ctx context.Context, r region.Region, summonerID string) ([]ChampionMastery, error) {
+	var res []ChampionMastery
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetAllChampionMasteries(ctx, r, summonerID)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetAllChampionMasteriesByPuuid(ctx context.Context, r region.Region, puuid string) ([]ChampionMastery, error) {
+	var res []ChampionMastery
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetAllChampionMasteriesByPuuid(ctx, r, puuid)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetChampionMastery(ctx context.Context, r region.Region, summonerID string, champ champion.Champion) (*ChampionMastery, error) {
+	var res *ChampionMastery
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetChampionMastery(ctx, r, summonerID, champ)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetChampionMasteryScore(ctx context.Context, r region.Region, summonerID string) (int, error) {
+	var res int
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetChampionMasteryScore(ctx, r, summonerID)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetChampions(ctx context.Context, r region.Region) (*ChampionList, error) {
+	var res *ChampionList
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetChampions(ctx, r)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetChampionByID(ctx context.Context, r region.Region, champ champion.Champion) (*Champion, error) {
+	var res *Champion
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetChampionByID(ctx, r, champ)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetChallengerLeague(ctx context.Context, r region.Region, q queue.Queue) (*LeagueList, error) {
+	var res *LeagueList
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetChallengerLeague(ctx, r, q)
+		p.pinLeague(res, i)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetGrandmasterLeague(ctx context.Context, r region.Region, q queue.Queue) (*LeagueList, error) {
+	var res *LeagueList
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetGrandmasterLeague(ctx, r, q)
+		p.pinLeague(res, i)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetMasterLeague(ctx context.Context, r region.Region, q queue.Queue) (*LeagueList, error) {
+	var res *LeagueList
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetMasterLeague(ctx, r, q)
+		p.pinLeague(res, i)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetAllLeaguePositionsForSummoner(ctx context.Context, r region.Region, summonerID string) ([]LeaguePosition, error) {
+	var res []LeaguePosition
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetAllLeaguePositionsForSummoner(ctx, r, summonerID)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetLeagueByID(ctx context.Context, r region.Region, leagueID string) (*LeagueList, error) {
+	var res *LeagueList
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetLeagueByID(ctx, r, leagueID)
+		p.pinLeague(res, i)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetMatch(ctx context.Context, r v5region.V5Region, matchID string) (*Match, error) {
+	var res *Match
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetMatch(ctx, r, matchID)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetMatchTimeline(ctx context.Context, r v5region.V5Region, matchID string) (*MatchTimeline, error) {
+	var res *MatchTimeline
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetMatchTimeline(ctx, r, matchID)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetMatchlist(ctx context.Context, r region.Region, accountID string, opts *GetMatchlistOptions) (*Matchlist, error) {
+	var res *Matchlist
+	err := p.byID(string(r), accountID, func(i int, c *client) (err error) {
+		res, err = c.GetMatchlist(ctx, r, accountID, opts)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetMatchIds(ctx context.Context, r v5region.V5Region, puuid string, opts *GetMatchIdsOptions) ([]string, error) {
+	var res []string
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetMatchIds(ctx, r, puuid, opts)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetRecentMatchlist(ctx context.Context, r region.Region, accountID string) (*Matchlist, error) {
+	var res *Matchlist
+	err := p.byID(string(r), accountID, func(i int, c *client) (err error) {
+		res, err = c.GetRecentMatchlist(ctx, r, accountID)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetFeaturedGames(ctx context.Context, r region.Region) (*FeaturedGames, error) {
+	var res *FeaturedGames
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetFeaturedGames(ctx, r)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetCurrentGameInfoBySummoner(ctx context.Context, r region.Region, summonerID string) (*CurrentGameInfo, error) {
+	var res *CurrentGameInfo
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetCurrentGameInfoBySummoner(ctx, r, summonerID)
+		if res != nil {
+			for _, pt := range res.Participants {
+				p.pin(pt.SummonerId, i)
+			}
+		}
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetByAccountID(ctx context.Context, r region.Region, accountID string) (*Summoner, error) {
+	var res *Summoner
+	err := p.byID(string(r), accountID, func(i int, c *client) (err error) {
+		res, err = c.GetByAccountID(ctx, r, accountID)
+		if err == nil {
+			p.pinSummoner(res, i)
+		}
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetBySummonerName(ctx context.Context, r region.Region, name string) (*Summoner, error) {
+	var res *Summoner
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetBySummonerName(ctx, r, name)
+		if err == nil {
+			p.pinSummoner(res, i)
+		}
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetBySummonerPUUID(ctx context.Context, r region.Region, puuid string) (*Summoner, error) {
+	var res *Summoner
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetBySummonerPUUID(ctx, r, puuid)
+		if err == nil {
+			p.pinSummoner(res, i)
+		}
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetRiotAccountByNameAndTag(ctx context.Context, r v5region.V5Region, name string, tag string) (*RiotAccount, error) {
+	var res *RiotAccount
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetRiotAccountByNameAndTag(ctx, r, name, tag)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetRiotAccountByPuuid(ctx context.Context, r v5region.V5Region, puuid string) (*RiotAccount, error) {
+	var res *RiotAccount
+	err := p.anyKey(string(r), func(i int, c *client) (err error) {
+		res, err = c.GetRiotAccountByPuuid(ctx, r, puuid)
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetBySummonerID(ctx context.Context, r region.Region, summonerID string) (*Summoner, error) {
+	var res *Summoner
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetBySummonerID(ctx, r, summonerID)
+		if err == nil {
+			p.pinSummoner(res, i)
+		}
+		return err
+	})
+	return res, err
+}
+
+func (p *pool) GetThirdPartyCodeByID(ctx context.Context, r region.Region, summonerID string) (string, error) {
+	var res string
+	err := p.byID(string(r), summonerID, func(i int, c *client) (err error) {
+		res, err = c.GetThirdPartyCodeByID(ctx, r, summonerID)
+		return err
+	})
+	return res, err
+}
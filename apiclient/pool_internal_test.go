@@ -0,0 +1,29 @@
+package apiclient
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPoolPinsBounded(t *testing.T) {
+	p := NewPool([]string{"a", "b"}, nil, nil).(*pool)
+	p.maxPins = 3
+	for i := 0; i < 4; i++ {
+		if i == 3 {
+			// Using the oldest ID keeps it over the others.
+			p.pinned("0")
+		}
+		p.pin(fmt.Sprint(i), i%2)
+	}
+	if len(p.pins) != 3 || p.pinLRU.Len() != 3 {
+		t.Errorf("got %d pins, want 3", len(p.pins))
+	}
+	if _, ok := p.pinned("1"); ok {
+		t.Error("the least recently used ID is still pinned")
+	}
+	for id, want := range map[string]int{"0": 0, "2": 0, "3": 1} {
+		if got, ok := p.pinned(id); !ok || got != want {
+			t.Errorf("pinned(%s) = %d, %v, want %d", id, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package apiclient_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/apiclient/riotmock"
+	"github.com/Tilo-K/riot/constants/champion"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/ratelimittest"
+)
+
+var poolKeys = []string{"key-a", "key-b"}
+
+// poolDoer serves each key from its own riotmock server, in which the summoner
+// has the IDs encrypted for that key. Like the real API, it answers requests
+// for IDs encrypted for another key with HTTP 400, and IDs ending in "-bad"
+// with a plain HTTP 400.
+type poolDoer struct {
+	servers map[string]*riotmock.Server
+
+	lock  sync.Mutex
+	calls []string
+}
+
+func newPoolDoer(t *testing.T, clock ratelimit.Clock) *poolDoer {
+	d := &poolDoer{servers: make(map[string]*riotmock.Server)}
+	for _, key := range poolKeys {
+		s, err := riotmock.NewServer(&riotmock.Dataset{
+			Platforms: map[region.Region]*riotmock.Platform{
+				region.NA1: {
+					Summoners: []apiclient.Summoner{{Name: "name", PUUID: "puuid", ID: "id-" + key, AccountID: "account-" + key}},
+					Masteries: []apiclient.ChampionMastery{{PlayerID: "id-" + key, ChampionID: champion.Ahri, ChampionLevel: 7}},
+				},
+			},
+		}, riotmock.WithKeys(key), riotmock.WithClock(clock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.servers[key] = s
+	}
+	return d
+}
+
+func (d *poolDoer) Do(req *http.Request) (*http.Response, error) {
+	key := req.Header.Get("X-Riot-Token")
+	d.lock.Lock()
+	d.calls = append(d.calls, key)
+	d.lock.Unlock()
+	if strings.HasSuffix(req.URL.Path, "-bad") {
+		return badRequest(req, "Bad Request"), nil
+	}
+	for _, other := range poolKeys {
+		if other != key && strings.HasSuffix(req.URL.Path, "-"+other) {
+			return badRequest(req, "Bad Request - Exception decrypting id-"+other), nil
+		}
+	}
+	return d.servers[key].Do(req)
+}
+
+func badRequest(req *http.Request, msg string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(`{"status":{"message":"` + msg + `","status_code":400}}`)),
+		Request:    req,
+	}
+}
+
+// take returns the keys used since the last call.
+func (d *poolDoer) take() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	calls := d.calls
+	d.calls = nil
+	return calls
+}
+
+func newTestPool(t *testing.T) (apiclient.Client, *poolDoer, ratelimit.Limiter) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	d := newPoolDoer(t, clock)
+	l := ratelimit.NewLimiterWithClock(clock)
+	return apiclient.NewPool(poolKeys, d, l), d, l
+}
+
+func TestPoolMostRemainingQuota(t *testing.T) {
+	ctx := context.Background()
+	p, d, l := newTestPool(t)
+
+	// Use part of the quota of the first key outside of the pool.
+	c := apiclient.New(poolKeys[0], d, l)
+	for i := 0; i < 5; i++ {
+		if _, err := c.GetBySummonerPUUID(ctx, region.NA1, "puuid"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.take()
+
+	// The second key has unknown limits at first, and then more quota.
+	for i := 0; i < 4; i++ {
+		if _, err := p.GetBySummonerPUUID(ctx, region.NA1, "puuid"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(d.take(), ","); got != "key-b,key-b,key-b,key-b" {
+		t.Errorf("got keys %s, want key-b for each call", got)
+	}
+}
+
+func TestPoolPinsIssuingKey(t *testing.T) {
+	ctx := context.Background()
+	p, d, _ := newTestPool(t)
+
+	s, err := p.GetBySummonerName(ctx, region.NA1, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := d.take()[0]
+	if s.ID != "id-"+key {
+		t.Fatalf("got summoner ID %s from %s", s.ID, key)
+	}
+
+	// The other key has more quota now, but cannot decrypt the ID.
+	for i := 0; i < 2; i++ {
+		if got, err := p.GetBySummonerID(ctx, region.NA1, s.ID); err != nil || got.PUUID != "puuid" {
+			t.Errorf("GetBySummonerID() = %+v, %v", got, err)
+		}
+		if ms, err := p.GetAllChampionMasteries(ctx, region.NA1, s.ID); err != nil || len(ms) != 1 {
+			t.Errorf("GetAllChampionMasteries() = %+v, %v", ms, err)
+		}
+	}
+	for _, got := range d.take() {
+		if got != key {
+			t.Errorf("got call with %s, want %s which issued the ID", got, key)
+		}
+	}
+}
+
+func TestPoolByIDFallback(t *testing.T) {
+	ctx := context.Background()
+	for _, key := range poolKeys {
+		p, d, _ := newTestPool(t)
+		// The ID was obtained elsewhere, so the pool does not know the key.
+		if got, err := p.GetBySummonerID(ctx, region.NA1, "id-"+key); err != nil || got.ID != "id-"+key {
+			t.Errorf("GetBySummonerID() = %+v, %v", got, err)
+		}
+		calls := d.take()
+		if len(calls) == 0 || calls[len(calls)-1] != key {
+			t.Errorf("got calls %v, want the last one with %s", calls, key)
+		}
+
+		// The key is pinned afterwards.
+		if _, err := p.GetAllChampionMasteries(ctx, region.NA1, "id-"+key); err != nil {
+			t.Error(err)
+		}
+		if calls := d.take(); len(calls) != 1 || calls[0] != key {
+			t.Errorf("got calls %v after pinning, want [%s]", calls, key)
+		}
+	}
+}
+
+func TestPoolByIDStopsOnBadRequest(t *testing.T) {
+	p, d, _ := newTestPool(t)
+	if _, err := p.GetBySummonerID(context.Background(), region.NA1, "id-bad"); err != apiclient.ErrBadRequest {
+		t.Errorf("got error %v, want ErrBadRequest", err)
+	}
+	if calls := d.take(); len(calls) != 1 {
+		t.Errorf("got calls %v, want one", calls)
+	}
+}
@@ -0,0 +1,153 @@
+package riotmock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+// Dataset is the data served by a Server.
+type Dataset struct {
+	// Platforms holds the data served by platform hosts, such as
+	// na1.api.riotgames.com.
+	Platforms map[region.Region]*Platform `json:"platforms"`
+
+	// Regions holds the data served by regional hosts, such as
+	// americas.api.riotgames.com.
+	Regions map[v5region.V5Region]*Regional `json:"regions"`
+}
+
+// Platform is the data of a single platform.
+type Platform struct {
+	Summoners []apiclient.Summoner `json:"summoners"`
+
+	// Leagues are served by ID, and by tier and queue for the challenger,
+	// grandmaster and master leagues.
+	Leagues []apiclient.LeagueList `json:"leagues"`
+
+	// LeaguePositions are keyed by encrypted summoner ID.
+	LeaguePositions map[string][]apiclient.LeaguePosition `json:"leaguePositions"`
+
+	// Masteries are served for the summoner identified by PlayerID.
+	Masteries []apiclient.ChampionMastery `json:"masteries"`
+
+	// ActiveGames are served for each participant by encrypted summoner ID.
+	ActiveGames   []apiclient.CurrentGameInfo `json:"activeGames"`
+	FeaturedGames *apiclient.FeaturedGames    `json:"featuredGames"`
+
+	// ThirdPartyCodes are keyed by encrypted summoner ID.
+	ThirdPartyCodes map[string]string `json:"thirdPartyCodes"`
+}
+
+// Regional is the data of a single regional host.
+type Regional struct {
+	Accounts []apiclient.RiotAccount `json:"accounts"`
+
+	// Matches are served by ID, and listed for each participant by PUUID,
+	// most recent first.
+	Matches   []apiclient.Match         `json:"matches"`
+	Timelines []apiclient.MatchTimeline `json:"timelines"`
+}
+
+// LoadDataset reads a Dataset from a JSON file.
+func LoadDataset(path string) (*Dataset, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d Dataset
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// platformIndex looks up the data of a platform.
+type platformIndex struct {
+	*Platform
+	byName      map[string]*apiclient.Summoner
+	byAccount   map[string]*apiclient.Summoner
+	byPUUID     map[string]*apiclient.Summoner
+	byID        map[string]*apiclient.Summoner
+	leagues     map[string]*apiclient.LeagueList
+	masteries   map[string][]apiclient.ChampionMastery
+	activeGames map[string]*apiclient.CurrentGameInfo
+}
+
+func newPlatformIndex(p *Platform) *platformIndex {
+	x := &platformIndex{
+		Platform:    p,
+		byName:      make(map[string]*apiclient.Summoner),
+		byAccount:   make(map[string]*apiclient.Summoner),
+		byPUUID:     make(map[string]*apiclient.Summoner),
+		byID:        make(map[string]*apiclient.Summoner),
+		leagues:     make(map[string]*apiclient.LeagueList),
+		masteries:   make(map[string][]apiclient.ChampionMastery),
+		activeGames: make(map[string]*apiclient.CurrentGameInfo),
+	}
+	for i := range p.Summoners {
+		s := &p.Summoners[i]
+		x.byName[normalizeName(s.Name)] = s
+		x.byAccount[s.AccountID] = s
+		x.byPUUID[s.PUUID] = s
+		x.byID[s.ID] = s
+	}
+	for i := range p.Leagues {
+		x.leagues[p.Leagues[i].LeagueID] = &p.Leagues[i]
+	}
+	for _, m := range p.Masteries {
+		x.masteries[m.PlayerID] = append(x.masteries[m.PlayerID], m)
+	}
+	for i := range p.ActiveGames {
+		g := &p.ActiveGames[i]
+		for _, part := range g.Participants {
+			x.activeGames[part.SummonerId] = g
+		}
+	}
+	return x
+}
+
+// regionalIndex looks up the data of a regional host.
+type regionalIndex struct {
+	*Regional
+	accountsByPUUID map[string]*apiclient.RiotAccount
+	accountsByID    map[string]*apiclient.RiotAccount
+	matches         map[string]*apiclient.Match
+	timelines       map[string]*apiclient.MatchTimeline
+
+	// matchesByPUUID lists the matches of each player, most recent first.
+	matchesByPUUID map[string][]*apiclient.Match
+}
+
+func newRegionalIndex(r *Regional) *regionalIndex {
+	x := &regionalIndex{
+		Regional:        r,
+		accountsByPUUID: make(map[string]*apiclient.RiotAccount),
+		accountsByID:    make(map[string]*apiclient.RiotAccount),
+		matches:         make(map[string]*apiclient.Match),
+		timelines:       make(map[string]*apiclient.MatchTimeline),
+		matchesByPUUID:  make(map[string][]*apiclient.Match),
+	}
+	for i := range r.Accounts {
+		a := &r.Accounts[i]
+		x.accountsByPUUID[a.Puuid] = a
+		x.accountsByID[normalizeName(a.GameName)+"#"+normalizeName(a.TagLine)] = a
+	}
+	for i := range r.Matches {
+		m := &r.Matches[i]
+		x.matches[m.Metadata.MatchID] = m
+		for _, puuid := range m.Metadata.Participants {
+			x.matchesByPUUID[puuid] = append(x.matchesByPUUID[puuid], m)
+		}
+	}
+	for _, ms := range x.matchesByPUUID {
+		sortMatches(ms)
+	}
+	for i := range r.Timelines {
+		x.timelines[r.Timelines[i].Metadata.MatchID] = &r.Timelines[i]
+	}
+	return x
+}
@@ -0,0 +1,273 @@
+package riotmock
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/tier"
+)
+
+const (
+	// defaultMatchCount and maxMatchCount bound the match IDs returned by a
+	// single call, as in the real API.
+	defaultMatchCount = 20
+	maxMatchCount     = 100
+)
+
+// call is a request to an endpoint, with the path parameters in order.
+type call struct {
+	params []string
+	query  url.Values
+}
+
+// platformHandler serves an endpoint of a platform host. It returns the
+// response value and the HTTP status.
+type platformHandler func(p *platformIndex, c call) (interface{}, int)
+
+// regionalHandler serves an endpoint of a regional host.
+type regionalHandler func(r *regionalIndex, c call) (interface{}, int)
+
+// route is an API endpoint.
+type route struct {
+	// name identifies the endpoint for method rate limits.
+	name string
+
+	// pattern is the path, where "*" matches a single segment.
+	pattern []string
+
+	platform platformHandler
+	regional regionalHandler
+}
+
+// match returns the path parameters if the path matches the route.
+func (rt *route) match(path []string) ([]string, bool) {
+	if len(path) != len(rt.pattern) {
+		return nil, false
+	}
+	var params []string
+	for i, p := range rt.pattern {
+		switch {
+		case p == "*":
+			params = append(params, path[i])
+		case p != path[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func platformRoute(name, pattern string, h platformHandler) *route {
+	return &route{name: name, pattern: strings.Split(strings.Trim(pattern, "/"), "/"), platform: h}
+}
+
+func regionalRoute(name, pattern string, h regionalHandler) *route {
+	return &route{name: name, pattern: strings.Split(strings.Trim(pattern, "/"), "/"), regional: h}
+}
+
+// found returns the value with HTTP OK, or HTTP not found if ok is false.
+func found(v interface{}, ok bool) (interface{}, int) {
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	return v, http.StatusOK
+}
+
+// normalizeName returns the name used to look up summoners and accounts,
+// which ignores case and spaces like the real API.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Replace(name, " ", "", -1))
+}
+
+// sortMatches sorts matches from most to least recent.
+func sortMatches(ms []*apiclient.Match) {
+	sort.SliceStable(ms, func(i, j int) bool {
+		return ms[i].Info.GameCreation > ms[j].Info.GameCreation
+	})
+}
+
+// apexLeague returns a handler for the apex league of the given tier.
+func apexLeague(t tier.Tier) platformHandler {
+	return func(p *platformIndex, c call) (interface{}, int) {
+		for i := range p.Leagues {
+			l := &p.Leagues[i]
+			if l.Tier == t && l.Queue.String() == c.params[0] {
+				return l, http.StatusOK
+			}
+		}
+		return nil, http.StatusNotFound
+	}
+}
+
+// queryInt returns the integer query parameter, or def if it is not set. ok
+// is false if the parameter is not an integer.
+func queryInt(q url.Values, name string, def int64) (int64, bool) {
+	s := q.Get(name)
+	if s == "" {
+		return def, true
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	return v, err == nil
+}
+
+// matchType returns the type of the match used to filter match IDs.
+func matchType(m *apiclient.Match) string {
+	switch {
+	case m.Info.TournamentCode != "":
+		return "tourney"
+	case m.Info.QueueID == int(queue.RankedSolo5x5) || m.Info.QueueID == queue.RankedFlexSR || m.Info.QueueID == queue.RankedFlexTT:
+		return "ranked"
+	case m.Info.QueueID >= 2000 && m.Info.QueueID <= 2020:
+		return "tutorial"
+	}
+	return "normal"
+}
+
+// matchIDs lists the match IDs of a player, filtered by the query parameters
+// of the real API. Times are in epoch seconds, and matches are compared by
+// creation time.
+func matchIDs(r *regionalIndex, c call) (interface{}, int) {
+	startTime, ok1 := queryInt(c.query, "startTime", 0)
+	endTime, ok2 := queryInt(c.query, "endTime", 0)
+	q, ok3 := queryInt(c.query, "queue", 0)
+	start, ok4 := queryInt(c.query, "start", 0)
+	count, ok5 := queryInt(c.query, "count", defaultMatchCount)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || start < 0 || count < 0 || count > maxMatchCount {
+		return nil, http.StatusBadRequest
+	}
+	typ := c.query.Get("type")
+
+	ids := []string{}
+	for _, m := range r.matchesByPUUID[c.params[0]] {
+		created := m.Info.GameCreation / 1000
+		switch {
+		case startTime != 0 && created < startTime:
+		case endTime != 0 && created > endTime:
+		case q != 0 && int64(m.Info.QueueID) != q:
+		case typ != "" && matchType(m) != typ:
+		default:
+			ids = append(ids, m.Metadata.MatchID)
+		}
+	}
+	if start > int64(len(ids)) {
+		start = int64(len(ids))
+	}
+	ids = ids[start:]
+	if count < int64(len(ids)) {
+		ids = ids[:count]
+	}
+	return ids, http.StatusOK
+}
+
+// routes are the endpoints used by apiclient.
+var routes = []*route{
+	// Champion Mastery API
+	platformRoute("champion-mastery-v4.getAllChampionMasteries", "/lol/champion-mastery/v4/champion-masteries/by-summoner/*", func(p *platformIndex, c call) (interface{}, int) {
+		ms, ok := p.masteries[c.params[0]]
+		if !ok {
+			ms = []apiclient.ChampionMastery{}
+		}
+		return found(ms, p.byID[c.params[0]] != nil)
+	}),
+	platformRoute("champion-mastery-v4.getAllChampionMasteriesByPUUID", "/lol/champion-mastery/v4/champion-masteries/by-puuid/*", func(p *platformIndex, c call) (interface{}, int) {
+		s, ok := p.byPUUID[c.params[0]]
+		if !ok {
+			return nil, http.StatusNotFound
+		}
+		ms, ok := p.masteries[s.ID]
+		if !ok {
+			ms = []apiclient.ChampionMastery{}
+		}
+		return ms, http.StatusOK
+	}),
+	platformRoute("champion-mastery-v4.getChampionMastery", "/lol/champion-mastery/v4/champion-masteries/by-summoner/*/by-champion/*", func(p *platformIndex, c call) (interface{}, int) {
+		for _, m := range p.masteries[c.params[0]] {
+			if strconv.FormatInt(int64(m.ChampionID), 10) == c.params[1] {
+				return m, http.StatusOK
+			}
+		}
+		return nil, http.StatusNotFound
+	}),
+	platformRoute("champion-mastery-v4.getChampionMasteryScore", "/lol/champion-mastery/v4/scores/by-summoner/*", func(p *platformIndex, c call) (interface{}, int) {
+		score := 0
+		for _, m := range p.masteries[c.params[0]] {
+			score += m.ChampionLevel
+		}
+		return found(score, p.byID[c.params[0]] != nil)
+	}),
+
+	// League API
+	platformRoute("league-v4.getChallengerLeague", "/lol/league/v4/challengerleagues/by-queue/*", apexLeague(tier.Challenger)),
+	platformRoute("league-v4.getGrandmasterLeague", "/lol/league/v4/grandmasterleagues/by-queue/*", apexLeague(tier.Grandmaster)),
+	platformRoute("league-v4.getMasterLeague", "/lol/league/v4/masterleagues/by-queue/*", apexLeague(tier.Master)),
+	platformRoute("league-v4.getLeagueById", "/lol/league/v4/leagues/*", func(p *platformIndex, c call) (interface{}, int) {
+		l, ok := p.leagues[c.params[0]]
+		return found(l, ok)
+	}),
+	platformRoute("league-v4.getLeagueEntriesForSummoner", "/lol/league/v4/entries/by-summoner/*", func(p *platformIndex, c call) (interface{}, int) {
+		ps, ok := p.LeaguePositions[c.params[0]]
+		if !ok {
+			ps = []apiclient.LeaguePosition{}
+		}
+		return found(ps, p.byID[c.params[0]] != nil)
+	}),
+
+	// Match API
+	regionalRoute("match-v5.getMatchIdsByPUUID", "/lol/match/v5/matches/by-puuid/*/ids", matchIDs),
+	regionalRoute("match-v5.getMatch", "/lol/match/v5/matches/*", func(r *regionalIndex, c call) (interface{}, int) {
+		m, ok := r.matches[c.params[0]]
+		return found(m, ok)
+	}),
+	regionalRoute("match-v5.getTimeline", "/lol/match/v5/matches/*/timeline", func(r *regionalIndex, c call) (interface{}, int) {
+		t, ok := r.timelines[c.params[0]]
+		return found(t, ok)
+	}),
+
+	// Spectator API
+	platformRoute("spectator-v4.getCurrentGameInfoBySummoner", "/lol/spectator/v4/active-games/by-summoner/*", func(p *platformIndex, c call) (interface{}, int) {
+		g, ok := p.activeGames[c.params[0]]
+		return found(g, ok)
+	}),
+	platformRoute("spectator-v4.getFeaturedGames", "/lol/spectator/v4/featured-games", func(p *platformIndex, c call) (interface{}, int) {
+		if p.FeaturedGames == nil {
+			return &apiclient.FeaturedGames{GameList: []apiclient.FeaturedGameInfoDTO{}}, http.StatusOK
+		}
+		return p.FeaturedGames, http.StatusOK
+	}),
+
+	// Summoner and Account APIs
+	platformRoute("summoner-v4.getByAccountId", "/lol/summoner/v4/summoners/by-account/*", func(p *platformIndex, c call) (interface{}, int) {
+		s, ok := p.byAccount[c.params[0]]
+		return found(s, ok)
+	}),
+	platformRoute("summoner-v4.getBySummonerName", "/lol/summoner/v4/summoners/by-name/*", func(p *platformIndex, c call) (interface{}, int) {
+		s, ok := p.byName[normalizeName(c.params[0])]
+		return found(s, ok)
+	}),
+	platformRoute("summoner-v4.getByPUUID", "/lol/summoner/v4/summoners/by-puuid/*", func(p *platformIndex, c call) (interface{}, int) {
+		s, ok := p.byPUUID[c.params[0]]
+		return found(s, ok)
+	}),
+	platformRoute("summoner-v4.getBySummonerId", "/lol/summoner/v4/summoners/*", func(p *platformIndex, c call) (interface{}, int) {
+		s, ok := p.byID[c.params[0]]
+		return found(s, ok)
+	}),
+	regionalRoute("account-v1.getByRiotId", "/riot/account/v1/accounts/by-riot-id/*/*", func(r *regionalIndex, c call) (interface{}, int) {
+		a, ok := r.accountsByID[normalizeName(c.params[0])+"#"+normalizeName(c.params[1])]
+		return found(a, ok)
+	}),
+	regionalRoute("account-v1.getByPuuid", "/riot/account/v1/accounts/by-puuid/*", func(r *regionalIndex, c call) (interface{}, int) {
+		a, ok := r.accountsByPUUID[c.params[0]]
+		return found(a, ok)
+	}),
+
+	// Third Party Code API
+	platformRoute("third-party-code-v4.getThirdPartyCodeBySummonerId", "/lol/platform/v4/third-party-code/by-summoner/*", func(p *platformIndex, c call) (interface{}, int) {
+		code, ok := p.ThirdPartyCodes[c.params[0]]
+		return found(code, ok)
+	}),
+}
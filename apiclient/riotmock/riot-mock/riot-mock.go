@@ -0,0 +1,59 @@
+// Launches a Riot API emulator on the specified port. See documentation in
+// github.com/Tilo-K/riot/apiclient/riotmock for the supported endpoints and
+// the dataset format.
+//
+// Usage example:
+//
+//	riot-mock --port=8080 --dataset=testdata/dataset.json --fixtures=testdata/fixtures
+//
+// Clients reach the emulator through riotmock.Redirect(), which keeps the
+// Riot API host in the Host header so that the region can be identified.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Tilo-K/riot/apiclient/riotmock"
+)
+
+var (
+	port         = flag.Int("port", 8080, "server port, used if --addr is empty")
+	addr         = flag.String("addr", "", "listen address, for example localhost:8080. Overrides --port")
+	dataset      = flag.String("dataset", "", "JSON file containing a riotmock.Dataset")
+	fixtures     = flag.String("fixtures", "", "directory of responses recorded by the fixture package, served for data missing from the dataset")
+	appLimits    = flag.String("app_limits", riotmock.DefaultAppLimits, "application rate limits per key and host, for example 20:1,100:120. Empty disables them")
+	methodLimits = flag.String("method_limits", riotmock.DefaultMethodLimits, "rate limits per endpoint, key and host. Empty disables them")
+)
+
+func main() {
+	flag.Parse()
+
+	var d *riotmock.Dataset
+	if *dataset != "" {
+		var err error
+		if d, err = riotmock.LoadDataset(*dataset); err != nil {
+			log.Fatal(err)
+		}
+	}
+	opts := []riotmock.Option{
+		riotmock.WithAppLimits(*appLimits),
+		riotmock.WithMethodLimits(*methodLimits),
+	}
+	if *fixtures != "" {
+		opts = append(opts, riotmock.WithFixtures(*fixtures))
+	}
+	s, err := riotmock.NewServer(d, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listen := *addr
+	if listen == "" {
+		listen = fmt.Sprintf(":%d", *port)
+	}
+	log.Println("listening on", listen)
+	log.Fatal(http.ListenAndServe(listen, s))
+}
@@ -0,0 +1,347 @@
+// Package riotmock emulates the Riot API for integration tests.
+//
+// A Server serves the endpoints used by apiclient from a Dataset, and
+// optionally from responses recorded by the fixture package, while enforcing
+// application and method rate limits with the same headers as the real API.
+// Use the Server directly as the Doer of an apiclient to call it in-process,
+// NewTestServer() to serve it over HTTP in tests, or the riot-mock command to
+// run it standalone.
+package riotmock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Tilo-K/riot/apiclient/fixture"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
+	"github.com/Tilo-K/riot/external"
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/ratelimittest"
+)
+
+const (
+	// DefaultAppLimits and DefaultMethodLimits are the limits of a
+	// development key.
+	DefaultAppLimits    = "20:1,100:120"
+	DefaultMethodLimits = "2000:60"
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAppLimits sets the application rate limits of each key on each host, in
+// the header format "COUNT:SECONDS,...". An empty string disables them.
+func WithAppLimits(limits string) Option {
+	return func(s *Server) {
+		s.appLimits = limits
+	}
+}
+
+// WithMethodLimits sets the rate limits of each endpoint for each key on each
+// host, in the same format as WithAppLimits.
+func WithMethodLimits(limits string) Option {
+	return func(s *Server) {
+		s.methodLimits = limits
+	}
+}
+
+// WithClock sets the clock used for rate limit windows, for example a
+// ratelimittest.FakeClock.
+func WithClock(c ratelimit.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// WithKeys restricts the accepted API keys. Requests with other keys are
+// answered with HTTP 403. By default, any key is accepted.
+func WithKeys(keys ...string) Option {
+	return func(s *Server) {
+		s.keys = make(map[string]bool)
+		for _, k := range keys {
+			s.keys[k] = true
+		}
+	}
+}
+
+// WithFixtures answers requests for data that is not in the Dataset with the
+// responses recorded in dir by fixture.NewRecorder(). Recorded rate limit
+// headers are replaced by those of the Server.
+func WithFixtures(dir string) Option {
+	return func(s *Server) {
+		s.fixtureDir = dir
+	}
+}
+
+// Server emulates the Riot API. It implements http.Handler, and
+// external.Doer by serving requests in-process. Hosts are identified by the
+// Host header, for example na1.api.riotgames.com. Server is threadsafe.
+type Server struct {
+	appLimits    string
+	methodLimits string
+	clock        ratelimit.Clock
+	keys         map[string]bool
+	fixtureDir   string
+	fixtures     external.Doer
+
+	platforms map[region.Region]*platformIndex
+	regions   map[v5region.V5Region]*regionalIndex
+
+	// limits simulates the rate limits of each key on each host.
+	lock   sync.Mutex
+	limits map[string]*ratelimittest.Server
+}
+
+// errorBody is the body of an error response from the real API.
+type errorBody struct {
+	Status struct {
+		Message    string `json:"message"`
+		StatusCode int    `json:"status_code"`
+	} `json:"status"`
+}
+
+// hostRegion returns the upper case region of a host such as
+// na1.api.riotgames.com.
+func hostRegion(host string) string {
+	if i := strings.IndexAny(host, ".:"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToUpper(host)
+}
+
+// limitsFor returns the rate limits of the key on the host.
+func (s *Server) limitsFor(key, host string) (*ratelimittest.Server, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := key + "@" + host
+	l, ok := s.limits[id]
+	if !ok {
+		var err error
+		l, err = ratelimittest.NewServer(s.clock, s.appLimits, s.methodLimits)
+		if err != nil {
+			return nil, err
+		}
+		s.limits[id] = l
+	}
+	return l, nil
+}
+
+// writeError writes an error response in the format of the real API.
+func writeError(w http.ResponseWriter, status int) {
+	var body errorBody
+	body.Status.Message = http.StatusText(status)
+	body.Status.StatusCode = status
+	writeJSON(w, status, &body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// lookup finds the route for the request, and calls it with the data of the
+// host.
+func (s *Server) lookup(r *http.Request) (rt *route, v interface{}, status int) {
+	host := hostRegion(r.Host)
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, rt := range routes {
+		params, ok := rt.match(path)
+		if !ok {
+			continue
+		}
+		c := call{params: params, query: r.URL.Query()}
+		switch {
+		case rt.platform != nil:
+			if p, ok := s.platforms[region.Region(host)]; ok {
+				v, status = rt.platform(p, c)
+				return rt, v, status
+			}
+		case rt.regional != nil:
+			if reg, ok := s.regions[v5region.V5Region(host)]; ok {
+				v, status = rt.regional(reg, c)
+				return rt, v, status
+			}
+		}
+		return rt, nil, http.StatusNotFound
+	}
+	return nil, nil, http.StatusNotFound
+}
+
+// serveFixture answers the request with a recorded response, and returns false
+// if there is none.
+func (s *Server) serveFixture(w http.ResponseWriter, r *http.Request) bool {
+	if s.fixtures == nil {
+		return false
+	}
+	u := *r.URL
+	u.Scheme = "https"
+	u.Host = r.Host
+	req, err := http.NewRequest(r.Method, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	res, err := s.fixtures.Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return false
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(res.StatusCode)
+	w.Write(b)
+	return true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Riot-Token")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	switch {
+	case key == "":
+		writeError(w, http.StatusUnauthorized)
+		return
+	case s.keys != nil && !s.keys[key]:
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	rt, v, status := s.lookup(r)
+	method := r.URL.Path
+	if rt != nil {
+		method = rt.name
+	}
+	limits, err := s.limitsFor(key, strings.ToLower(r.Host))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The simulated server decides whether the call is within the limits, and
+	// provides the headers for the response.
+	limited := limits.Call(method)
+	for k, vs := range limited.Header {
+		w.Header()[k] = vs
+	}
+	switch {
+	case limited.StatusCode != http.StatusOK:
+		writeError(w, limited.StatusCode)
+	case status == http.StatusNotFound && s.serveFixture(w, r):
+	case status != http.StatusOK:
+		writeError(w, status)
+	default:
+		writeJSON(w, status, v)
+	}
+}
+
+// Do serves the request in-process, so that a Server can be passed to
+// apiclient.New() in place of an HTTP client.
+func (s *Server) Do(req *http.Request) (*http.Response, error) {
+	r := req
+	if r.Host == "" {
+		r = req.Clone(req.Context())
+		r.Host = req.URL.Host
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	res := w.Result()
+	res.Request = req
+	return res, nil
+}
+
+// NewServer returns a Server for the given Dataset, with the rate limits of a
+// development key unless configured otherwise. The Dataset must not be
+// modified afterwards.
+func NewServer(d *Dataset, opts ...Option) (*Server, error) {
+	s := &Server{
+		appLimits:    DefaultAppLimits,
+		methodLimits: DefaultMethodLimits,
+		clock:        ratelimit.SystemClock,
+		platforms:    make(map[region.Region]*platformIndex),
+		regions:      make(map[v5region.V5Region]*regionalIndex),
+		limits:       make(map[string]*ratelimittest.Server),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if d != nil {
+		for r, p := range d.Platforms {
+			s.platforms[region.Region(strings.ToUpper(string(r)))] = newPlatformIndex(p)
+		}
+		for r, reg := range d.Regions {
+			s.regions[v5region.V5Region(strings.ToUpper(string(r)))] = newRegionalIndex(reg)
+		}
+	}
+	if s.fixtureDir != "" {
+		f, err := fixture.NewReplayer(s.fixtureDir)
+		if err != nil {
+			return nil, err
+		}
+		s.fixtures = f
+	}
+	// Validate the limits before serving.
+	if _, err := ratelimittest.NewServer(s.clock, s.appLimits, s.methodLimits); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// redirect sends requests for any host to a Server listening at base, keeping
+// the original host in the Host header.
+type redirect struct {
+	base *url.URL
+	d    external.Doer
+}
+
+func (r *redirect) Do(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Host = req.URL.Host
+	u := *req.URL
+	u.Scheme = r.base.Scheme
+	u.Host = r.base.Host
+	out.URL = &u
+	res, err := r.d.Do(out)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+// Redirect returns a Doer that sends requests for Riot API hosts to a Server
+// listening at base, for example the riot-mock command, using the given Doer.
+func Redirect(base *url.URL, d external.Doer) external.Doer {
+	return &redirect{base: base, d: d}
+}
+
+// NewTestServer starts an httptest.Server for the Dataset, and returns it with
+// a Doer that redirects Riot API requests to it. The caller should Close the
+// server when done.
+func NewTestServer(d *Dataset, opts ...Option) (*httptest.Server, external.Doer, error) {
+	s, err := NewServer(d, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts := httptest.NewServer(s)
+	base, err := url.Parse(ts.URL)
+	if err != nil {
+		ts.Close()
+		return nil, nil, err
+	}
+	return ts, Redirect(base, ts.Client()), nil
+}
@@ -0,0 +1,222 @@
+package riotmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/apiclient/apiclienttest"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/tier"
+	"github.com/Tilo-K/riot/constants/v5region"
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/ratelimittest"
+)
+
+// dataset returns a summoner with three matches, created at 1000, 2000 and
+// 3000 seconds, and a challenger league.
+func dataset() *Dataset {
+	var matches []apiclient.Match
+	for i := 1; i <= 3; i++ {
+		var m apiclient.Match
+		m.Metadata.MatchID = fmt.Sprintf("NA1_%d", i)
+		m.Metadata.Participants = []string{"puuid"}
+		m.Info.GameCreation = int64(i) * 1000 * 1000
+		m.Info.QueueID = int(queue.RankedSolo5x5)
+		if i == 2 {
+			m.Info.QueueID = queue.RankedFlexSR
+		}
+		matches = append(matches, m)
+	}
+	return &Dataset{
+		Platforms: map[region.Region]*Platform{
+			region.NA1: {
+				Summoners: []apiclient.Summoner{{Name: "Some Name", ID: "id", PUUID: "puuid", AccountID: "account"}},
+				Leagues: []apiclient.LeagueList{{
+					LeagueID: "league",
+					Tier:     tier.Challenger,
+					Queue:    queue.RankedSolo5x5,
+					Entries:  []apiclient.LeagueItem{{SummonerID: "id", LeaguePoints: 1000}},
+				}},
+			},
+		},
+		Regions: map[v5region.V5Region]*Regional{
+			v5region.Americas: {
+				Accounts: []apiclient.RiotAccount{{Puuid: "puuid", GameName: "Some Name", TagLine: "NA1"}},
+				Matches:  matches,
+			},
+		},
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewServer(dataset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := apiclient.New("key", s, ratelimit.NewLimiter())
+
+	sum, err := c.GetBySummonerName(ctx, region.NA1, "somename")
+	if err != nil || sum.PUUID != "puuid" {
+		t.Errorf("GetBySummonerName() = %+v, %v", sum, err)
+	}
+	acc, err := c.GetRiotAccountByNameAndTag(ctx, v5region.Americas, "Some Name", "NA1")
+	if err != nil || acc.Puuid != "puuid" {
+		t.Errorf("GetRiotAccountByNameAndTag() = %+v, %v", acc, err)
+	}
+	league, err := c.GetChallengerLeague(ctx, region.NA1, queue.RankedSolo5x5)
+	if err != nil || len(league.Entries) != 1 || league.Entries[0].LeaguePoints != 1000 {
+		t.Errorf("GetChallengerLeague() = %+v, %v", league, err)
+	}
+	m, err := c.GetMatch(ctx, v5region.Americas, "NA1_2")
+	if err != nil || m.Metadata.MatchID != "NA1_2" {
+		t.Errorf("GetMatch() = %+v, %v", m, err)
+	}
+	ids, err := c.GetMatchIds(ctx, v5region.Americas, "puuid", &apiclient.GetMatchIdsOptions{Queue: queue.RankedSolo5x5})
+	if err != nil || fmt.Sprint(ids) != "[NA1_3 NA1_1]" {
+		t.Errorf("GetMatchIds() = %v, %v; want [NA1_3 NA1_1]", ids, err)
+	}
+	if _, err := c.GetMatchTimeline(ctx, v5region.Americas, "NA1_2"); err != apiclient.ErrDataNotFound {
+		t.Errorf("GetMatchTimeline() error = %v, want ErrDataNotFound", err)
+	}
+	if _, err := c.GetBySummonerName(ctx, region.EUW1, "somename"); err != apiclient.ErrDataNotFound {
+		t.Errorf("GetBySummonerName() on another platform error = %v, want ErrDataNotFound", err)
+	}
+}
+
+func TestMatchIDsQuery(t *testing.T) {
+	s, err := NewServer(dataset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", "[NA1_3 NA1_2 NA1_1]"},
+		{"startTime=1500&endTime=3000", "[NA1_3 NA1_2]"},
+		{"start=1&count=1", "[NA1_2]"},
+		{"queue=440", "[NA1_2]"},
+		{"type=ranked", "[NA1_3 NA1_2 NA1_1]"},
+		{"type=normal", "[]"},
+		{"start=5", "[]"},
+	} {
+		var ids []string
+		req, _ := http.NewRequest("GET", "https://americas.api.riotgames.com/lol/match/v5/matches/by-puuid/puuid/ids?"+tc.query, nil)
+		req.Header.Set("X-Riot-Token", "key")
+		res, err := s.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewDecoder(res.Body).Decode(&ids); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(ids); got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestMatchIdsIterator(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewServer(dataset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := apiclient.New("key", s, ratelimit.NewLimiter())
+	for _, tc := range []struct {
+		opts apiclient.GetMatchIdsOptions
+		want string
+	}{
+		{apiclient.GetMatchIdsOptions{}, "[NA1_3 NA1_2 NA1_1]"},
+		{apiclient.GetMatchIdsOptions{Count: 1}, "[NA1_3 NA1_2 NA1_1]"},
+		{apiclient.GetMatchIdsOptions{Count: 2, Start: 1}, "[NA1_2 NA1_1]"},
+		{apiclient.GetMatchIdsOptions{Count: 1, StartTime: time.Unix(1500, 0), EndTime: time.Unix(3000, 0)}, "[NA1_3 NA1_2]"},
+		{apiclient.GetMatchIdsOptions{Count: 1, Queue: queue.RankedSolo5x5, Type: "ranked"}, "[NA1_3 NA1_1]"},
+		{apiclient.GetMatchIdsOptions{Type: "normal"}, "[]"},
+	} {
+		opts := tc.opts
+		ids, err := apiclient.GetAllMatchIds(ctx, c, v5region.Americas, "puuid", &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(ids); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.opts, got, tc.want)
+		}
+	}
+
+	// The iteration stops at the first error, after the IDs already fetched.
+	f := apiclienttest.NewFake()
+	f.Return("GetMatchIds", []string{"NA1_3", "NA1_2"})
+	f.Fail("GetMatchIds", apiclient.ErrServiceUnavailable)
+	it := apiclient.NewMatchIdsIterator(f, v5region.Americas, "puuid", &apiclient.GetMatchIdsOptions{Count: 2})
+	var ids []string
+	for it.Next(ctx) {
+		ids = append(ids, it.ID())
+	}
+	if fmt.Sprint(ids) != "[NA1_3 NA1_2]" || it.Err() != apiclient.ErrServiceUnavailable {
+		t.Errorf("got %v with error %v", ids, it.Err())
+	}
+	if calls := f.Calls("GetMatchIds"); len(calls) != 2 || calls[0].Args[2].(*apiclient.GetMatchIdsOptions).Start != 0 || calls[1].Args[2].(*apiclient.GetMatchIdsOptions).Start != 2 {
+		t.Errorf("got calls %+v", calls)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	s, err := NewServer(dataset(), WithClock(clock), WithAppLimits("2:10"), WithMethodLimits(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(key string) *http.Response {
+		req, _ := http.NewRequest("GET", "https://na1.api.riotgames.com/lol/summoner/v4/summoners/by-puuid/puuid", nil)
+		req.Header.Set("X-Riot-Token", key)
+		res, err := s.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := call("a"); res.StatusCode != http.StatusOK {
+			t.Fatalf("call %d: got status %d", i, res.StatusCode)
+		}
+	}
+	res := call("a")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "10" || res.Header.Get("X-App-Rate-Limit") != "2:10" {
+		t.Errorf("got status %d with headers %v, want 429 after 10s", res.StatusCode, res.Header)
+	}
+	// Limits are per key.
+	if res := call("b"); res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for another key", res.StatusCode)
+	}
+	clock.Advance(10 * time.Second)
+	if res := call("a"); res.StatusCode != http.StatusOK || res.Header.Get("X-App-Rate-Limit-Count") != "1:10" {
+		t.Errorf("got status %d with headers %v after the window", res.StatusCode, res.Header)
+	}
+}
+
+func TestTestServer(t *testing.T) {
+	ts, doer, err := NewTestServer(dataset(), WithKeys("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := apiclient.New("key", doer, ratelimit.NewLimiter())
+	if sum, err := c.GetBySummonerPUUID(ctx, region.NA1, "puuid"); err != nil || sum.ID != "id" {
+		t.Errorf("GetBySummonerPUUID() = %+v, %v", sum, err)
+	}
+	c = apiclient.New("other", doer, ratelimit.NewLimiter())
+	if _, err := c.GetBySummonerPUUID(ctx, region.NA1, "puuid"); err != apiclient.ErrForbidden {
+		t.Errorf("got %v for an unknown key, want ErrForbidden", err)
+	}
+}
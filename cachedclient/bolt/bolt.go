@@ -0,0 +1,386 @@
+// Package bolt implements file-backed persistence for cached RPC calls.
+//
+// Use the NewDatastore() constructor to open a Datastore backed by a single
+// bbolt database file, which survives restarts without any external service.
+package bolt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/cachedclient"
+
+	bbolt "go.etcd.io/bbolt"
+)
+
+var (
+	zeroTime time.Time
+
+	// bucket holds all values.
+	bucket = []byte("values")
+)
+
+const (
+	// Each stored value starts with a byte identifying its encoding.
+	encodingRaw  = 0
+	encodingGzip = 1
+
+	// compactTxSize is the maximum size of a transaction while compacting.
+	compactTxSize = 64 << 20
+
+	// purgeBatchSize is the maximum number of versions PurgePrefix deletes in
+	// a single transaction.
+	purgeBatchSize = 1000
+)
+
+// Datastore is a cachedclient.Datastore backed by a database file.
+type Datastore interface {
+	cachedclient.HistoryDatastore
+
+	// Compact rewrites the database file to reclaim space freed by Purge.
+	// Other calls block until compaction is complete. If compaction fails, then
+	// the original file remains in use.
+	Compact() error
+
+	// Close closes the database file.
+	Close() error
+}
+
+// Option configures a bolt datastore.
+type Option func(*boltDatastore)
+
+// WithCompression gzip-compresses values whose JSON encoding is at least
+// minSize bytes, such as match timelines. Values written without compression
+// remain readable, so the option can be changed for an existing file.
+func WithCompression(minSize int) Option {
+	return func(b *boltDatastore) {
+		b.compress = true
+		b.minCompressSize = minSize
+	}
+}
+
+// WithOptions sets the options used to open the database file.
+func WithOptions(opts *bbolt.Options) Option {
+	return func(b *boltDatastore) {
+		b.opts = opts
+	}
+}
+
+type boltDatastore struct {
+	path            string
+	opts            *bbolt.Options
+	compress        bool
+	minCompressSize int
+
+	// lock protects db, which is replaced during compaction.
+	lock sync.RWMutex
+	db   *bbolt.DB
+}
+
+// escapeKey returns the key with each zero byte followed by 0xff, so that the
+// escaped key never contains the separator written by keyPrefix. Escaping
+// preserves order and prefixes, so the keys starting with a prefix are exactly
+// the stored keys starting with its escaped form.
+func escapeKey(key string) []byte {
+	b := make([]byte, 0, len(key)+2)
+	for i := 0; i < len(key); i++ {
+		b = append(b, key[i])
+		if key[i] == 0 {
+			b = append(b, 0xff)
+		}
+	}
+	return b
+}
+
+// keyPrefix returns the prefix shared by all versions of the key. The escaped
+// key is followed by a separator so that no key is a prefix of another.
+func keyPrefix(key string) []byte {
+	return append(escapeKey(key), 0, 1)
+}
+
+// timeSuffix encodes the time such that later times sort first. The zero time
+// sorts last, so it is treated as older than all other versions.
+func timeSuffix(t time.Time) []byte {
+	b := make([]byte, 8)
+	if t.IsZero() {
+		binary.BigEndian.PutUint64(b, math.MaxUint64)
+		return b
+	}
+	// Flipping the sign bit maps int64 order to uint64 order, and inverting
+	// sorts descending.
+	binary.BigEndian.PutUint64(b, ^(uint64(t.UnixNano()) ^ (1 << 63)))
+	return b
+}
+
+// suffixTime is the inverse of timeSuffix.
+func suffixTime(b []byte) time.Time {
+	v := binary.BigEndian.Uint64(b)
+	if v == math.MaxUint64 {
+		return zeroTime
+	}
+	return time.Unix(0, int64(^v^(1<<63)))
+}
+
+// encode returns the stored representation of the value.
+func (b *boltDatastore) encode(val interface{}) ([]byte, error) {
+	js, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	if !b.compress || len(js) < b.minCompressSize {
+		return append([]byte{encodingRaw}, js...), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(encodingGzip)
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(js); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode unmarshals the stored representation into dest.
+func decode(stored []byte, dest interface{}) error {
+	if len(stored) == 0 {
+		return fmt.Errorf("empty value")
+	}
+	js := stored[1:]
+	switch stored[0] {
+	case encodingRaw:
+	case encodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(js))
+		if err != nil {
+			return err
+		}
+		js, err = ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown value encoding %d", stored[0])
+	}
+	return json.Unmarshal(js, dest)
+}
+
+func (b *boltDatastore) Get(ctx context.Context, key string, dest interface{}, t time.Time) (time.Time, error) {
+	prefix := keyPrefix(key)
+	var (
+		found  []byte
+		foundT time.Time
+	)
+	b.lock.RLock()
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		// Seeking to t finds the most recent version not after t, or the
+		// unversioned value if t is zero.
+		k, v := c.Seek(append(prefix, timeSuffix(t)...))
+		if k == nil || !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		// Values are only valid during the transaction.
+		found = append([]byte(nil), v...)
+		foundT = suffixTime(k[len(prefix):])
+		return nil
+	})
+	b.lock.RUnlock()
+	if err != nil {
+		return zeroTime, err
+	}
+	if found == nil {
+		return zeroTime, fmt.Errorf("key %q is missing", key)
+	}
+	if err := decode(found, dest); err != nil {
+		return zeroTime, err
+	}
+	return foundT, nil
+}
+
+func (b *boltDatastore) Put(ctx context.Context, key string, val interface{}, t time.Time) error {
+	stored, err := b.encode(val)
+	if err != nil {
+		return err
+	}
+	k := append(keyPrefix(key), timeSuffix(t)...)
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Put(k, stored)
+	})
+}
+
+func (b *boltDatastore) Purge(ctx context.Context, key string, keep int) error {
+	prefix := keyPrefix(key)
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bk := tx.Bucket(bucket)
+		c := bk.Cursor()
+		// Versions are sorted from most recent to oldest, so skip the first
+		// keep versions and delete the rest.
+		var remove [][]byte
+		i := 0
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if i++; i > keep {
+				remove = append(remove, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range remove {
+			if err := bk.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltDatastore) PurgePrefix(ctx context.Context, prefix string) error {
+	start := escapeKey(prefix)
+	// Matching keys are adjacent, so each batch deletes from the start of the
+	// range until it is empty. Deleting in batches keeps other writers from
+	// waiting for one large transaction.
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var n int
+		b.lock.RLock()
+		err := b.db.Update(func(tx *bbolt.Tx) error {
+			bk := tx.Bucket(bucket)
+			c := bk.Cursor()
+			var remove [][]byte
+			for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, start) && len(remove) < purgeBatchSize; k, _ = c.Next() {
+				remove = append(remove, append([]byte(nil), k...))
+			}
+			for _, k := range remove {
+				if err := bk.Delete(k); err != nil {
+					return err
+				}
+			}
+			n = len(remove)
+			return nil
+		})
+		b.lock.RUnlock()
+		if err != nil || n < purgeBatchSize {
+			return err
+		}
+	}
+}
+
+func (b *boltDatastore) Versions(ctx context.Context, key string, start, end time.Time) ([]time.Time, error) {
+	prefix := keyPrefix(key)
+	var res []time.Time
+	b.lock.RLock()
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		// Versions are sorted from most recent to oldest, so start at end and
+		// stop at start or at the unversioned value.
+		for k, _ := c.Seek(append(prefix, timeSuffix(end)...)); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			t := suffixTime(k[len(prefix):])
+			if t.IsZero() || t.Before(start) {
+				break
+			}
+			res = append(res, t)
+		}
+		return nil
+	})
+	b.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, nil
+}
+
+func (b *boltDatastore) Compact() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	tmp := b.path + ".compact"
+	os.Remove(tmp)
+	dst, err := bbolt.Open(tmp, 0600, b.opts)
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, b.db, compactTxSize); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := b.db.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		// Keep serving from the original file, which is left unchanged.
+		os.Remove(tmp)
+		if openErr := b.reopen(); openErr != nil {
+			return fmt.Errorf("%v, and reopening failed: %v", err, openErr)
+		}
+		return err
+	}
+	return b.reopen()
+}
+
+// reopen opens the database file again after it was closed. If that fails,
+// then the closed database is kept, so that later calls fail with
+// bbolt.ErrDatabaseNotOpen instead of panicking.
+func (b *boltDatastore) reopen() error {
+	db, err := bbolt.Open(b.path, 0600, b.opts)
+	if err != nil {
+		return err
+	}
+	b.db = db
+	return nil
+}
+
+func (b *boltDatastore) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.db.Close()
+}
+
+// NewDatastore opens or creates the database file at the given path. Values
+// are stored JSON-encoded, keyed by cache key and timestamp, so that the most
+// recent value before a time is found with a single lookup. Only one process
+// can open the file at a time. The returned Datastore is threadsafe.
+func NewDatastore(path string, opts ...Option) (Datastore, error) {
+	b := &boltDatastore{
+		path: path,
+		opts: &bbolt.Options{Timeout: time.Second},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	db, err := bbolt.Open(path, 0600, b.opts)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	b.db = db
+	return b, nil
+}
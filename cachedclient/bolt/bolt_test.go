@@ -0,0 +1,147 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+)
+
+type value struct {
+	S string
+}
+
+// get returns the value for the key at the given time, and false if it is
+// missing.
+func get(t *testing.T, d Datastore, key string, at time.Time) (string, time.Time, bool) {
+	t.Helper()
+	var v value
+	ts, err := d.Get(context.Background(), key, &v, at)
+	if err != nil {
+		return "", ts, false
+	}
+	return v.S, ts, true
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewDatastore(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	t1 := time.Unix(100, 0)
+	t2 := time.Unix(200, 0)
+	d.Put(ctx, "k", value{"zero"}, zeroTime)
+	d.Put(ctx, "k", value{"two"}, t2)
+	d.Put(ctx, "k", value{"one"}, t1)
+	// A key that shares a string prefix must not be confused with k.
+	d.Put(ctx, "kk", value{"other"}, time.Unix(150, 0))
+
+	for _, tc := range []struct {
+		at   time.Time
+		want string
+		ts   time.Time
+	}{
+		{zeroTime, "zero", zeroTime},
+		{time.Unix(50, 0), "zero", zeroTime},
+		{t1, "one", t1},
+		{time.Unix(150, 0), "one", t1},
+		{time.Unix(300, 0), "two", t2},
+	} {
+		got, ts, ok := get(t, d, "k", tc.at)
+		if !ok || got != tc.want || !ts.Equal(tc.ts) {
+			t.Errorf("Get(%v) = %q, %v, %v; want %q, %v", tc.at, got, ts, ok, tc.want, tc.ts)
+		}
+	}
+
+	if err := d.Purge(ctx, "k", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "k", time.Unix(150, 0)); ok {
+		t.Error("got purged version")
+	}
+	if _, _, ok := get(t, d, "k", zeroTime); ok {
+		t.Error("got purged unversioned value")
+	}
+	if got, _, ok := get(t, d, "k", time.Unix(300, 0)); !ok || got != "two" {
+		t.Errorf("got %q, %v after purge, want two", got, ok)
+	}
+	if got, _, ok := get(t, d, "kk", time.Unix(300, 0)); !ok || got != "other" {
+		t.Errorf("purge removed another key: got %q, %v", got, ok)
+	}
+}
+
+func TestCompressionAndCompaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	d, err := NewDatastore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Put(ctx, "raw", value{"small"}, zeroTime)
+	d.Close()
+
+	// Values written before compression was enabled remain readable.
+	d, err = NewDatastore(path, WithCompression(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	large := strings.Repeat("timeline ", 1000)
+	for i := 0; i < 100; i++ {
+		d.Put(ctx, "large", value{large}, time.Unix(int64(i+1), 0))
+	}
+	if err := d.Purge(ctx, "large", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _, ok := get(t, d, "raw", zeroTime); !ok || got != "small" {
+		t.Errorf("got %q, %v, want small", got, ok)
+	}
+	if got, ts, ok := get(t, d, "large", time.Unix(1000, 0)); !ok || got != large || !ts.Equal(time.Unix(100, 0)) {
+		t.Errorf("got %d bytes at %v, %v; want %d bytes at 100", len(got), ts, ok, len(large))
+	}
+}
+
+func TestPurgePrefix(t *testing.T) {
+	ctx := context.Background()
+	d, err := NewDatastore(filepath.Join(t.TempDir(), "cache.db"), WithOptions(&bbolt.Options{Timeout: time.Second, NoSync: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, key := range []string{"get-match:a", "get-match:bb", "get-match-timeline:a", "get-match", "get-match\x00:a"} {
+		d.Put(ctx, key, value{key}, zeroTime)
+		d.Put(ctx, key, value{key}, time.Unix(100, 0))
+	}
+	// Spans several batches.
+	for i := 0; i < purgeBatchSize; i++ {
+		d.Put(ctx, "get-match:c", value{"c"}, time.Unix(int64(i+1), 0))
+	}
+	if err := d.PurgePrefix(ctx, "get-match:"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "get-match:c", time.Unix(int64(purgeBatchSize), 0)); ok {
+		t.Error("got get-match:c present after purge")
+	}
+	for key, want := range map[string]bool{
+		"get-match:a":          false,
+		"get-match:bb":         false,
+		"get-match-timeline:a": true,
+		"get-match":            true,
+		"get-match\x00:a":      true,
+	} {
+		if _, _, ok := get(t, d, key, time.Unix(100, 0)); ok != want {
+			t.Errorf("got %s present %v, want %v", key, ok, want)
+		}
+	}
+}
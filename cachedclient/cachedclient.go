@@ -2,12 +2,16 @@
 // is backed by a Datastore that persists RPC results, and a Client that calls
 // to Riot in the event an RPC is not available in the Cache.
 //
-// Use the New() constructor to initialize a Client.
+// Use the New() constructor to initialize a Client. Each Client method has a
+// caching Policy, which can be overridden with the WithPolicy() option.
+//
+// Results of methods whose Policy keeps history can be read back over a time
+// range with NewHistoryClient().
 package cachedclient
 
 import (
 	"context"
-	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Tilo-K/riot/apiclient"
@@ -23,7 +27,27 @@ var zeroTime time.Time
 type client struct {
 	apiclient.Client
 
-	d Datastore
+	d        Datastore
+	policies map[string]Policy
+	flight   flight
+
+	// staleWhileRevalidate and staleIfError are client-wide minimums for the
+	// corresponding Policy fields.
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+
+	// notFoundTTL is the default for Policy.NotFoundTTL.
+	notFoundTTL time.Duration
+
+	// refreshing contains the keys being revalidated in the background.
+	refreshLock sync.Mutex
+	refreshing  map[string]bool
+
+	statsLock sync.Mutex
+	stats     map[string]*Stats
+
+	// janitor purges old values in the background.
+	janitor *janitor
 }
 
 // Datastore is a key-time-value store used to cache values.
@@ -43,110 +67,199 @@ type Datastore interface {
 	// only the most recent value for the key will be kept, and the rest will be
 	// deleted.
 	Purge(ctx context.Context, key string, keep int) error
+
+	// PurgePrefix removes all values for all keys that start with the given
+	// prefix.
+	PurgePrefix(ctx context.Context, prefix string) error
+}
+
+// Client is a cached apiclient.Client that can report on and control its
+// cache.
+type Client interface {
+	apiclient.Client
+
+	// Stats returns the counters for each method that has been called, keyed
+	// by method name.
+	Stats() map[string]Stats
+
+	// Inspect returns the cached entry for a call to the method with the given
+	// arguments, or ErrNotCached. The arguments are those that the cache key is
+	// derived from, which are the method's arguments except for options. For
+	// GetMatchIds, the options may be passed as the last argument.
+	Inspect(ctx context.Context, method string, args ...interface{}) (*Entry, error)
+
+	// Invalidate removes the cached results for a call to the method with the
+	// given arguments, including any earlier results kept as history, so that
+	// the next call fetches a fresh result. If only some leading arguments are
+	// given, then all results that share them are removed. For example,
+	// Invalidate(ctx, "GetChampionMastery", region.NA1, summonerID) removes the
+	// summoner's mastery for every champion.
+	Invalidate(ctx context.Context, method string, args ...interface{}) error
+
+	// Close waits for background purges of old values to finish, and stops
+	// the workers that run them. The client can still be used after Close,
+	// but old values are no longer purged.
+	Close() error
+}
+
+func (c *client) GetAllChampionMasteries(ctx context.Context, r region.Region, summonerID string) ([]apiclient.ChampionMastery, error) {
+	var val championMasteries
+	key := methodKey("GetAllChampionMasteries", r, summonerID)
+	err := c.cached(ctx, "GetAllChampionMasteries", key, &val, func(ctx context.Context) (interface{}, error) {
+		res, err := c.Client.GetAllChampionMasteries(ctx, r, summonerID)
+		return &championMasteries{res}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.Masteries, nil
+}
+
+func (c *client) GetAllChampionMasteriesByPuuid(ctx context.Context, r region.Region, puuid string) ([]apiclient.ChampionMastery, error) {
+	var val championMasteries
+	key := methodKey("GetAllChampionMasteriesByPuuid", r, puuid)
+	err := c.cached(ctx, "GetAllChampionMasteriesByPuuid", key, &val, func(ctx context.Context) (interface{}, error) {
+		res, err := c.Client.GetAllChampionMasteriesByPuuid(ctx, r, puuid)
+		return &championMasteries{res}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.Masteries, nil
+}
+
+func (c *client) GetChampionMastery(ctx context.Context, r region.Region, summonerID string, champ champion.Champion) (*apiclient.ChampionMastery, error) {
+	var val apiclient.ChampionMastery
+	key := methodKey("GetChampionMastery", r, summonerID, champ)
+	err := c.cached(ctx, "GetChampionMastery", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetChampionMastery(ctx, r, summonerID, champ)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
+
+func (c *client) GetChampionMasteryScore(ctx context.Context, r region.Region, summonerID string) (int, error) {
+	var val championMasteryScore
+	key := methodKey("GetChampionMasteryScore", r, summonerID)
+	err := c.cached(ctx, "GetChampionMasteryScore", key, &val, func(ctx context.Context) (interface{}, error) {
+		res, err := c.Client.GetChampionMasteryScore(ctx, r, summonerID)
+		return &championMasteryScore{res}, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return val.Score, nil
 }
 
 func (c *client) GetChampions(ctx context.Context, r region.Region) (*apiclient.ChampionList, error) {
 	var val apiclient.ChampionList
-	key := fmt.Sprintf("get-champions:%s", r)
-	t, err := c.d.Get(ctx, key, &val, zeroTime)
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return &val, nil
-	}
-	res, err := c.Client.GetChampions(ctx, r)
+	key := methodKey("GetChampions", r)
+	err := c.cached(ctx, "GetChampions", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetChampions(ctx, r)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return res, err
+	return &val, nil
 }
 
-func (c *client) GetChampionsByID(ctx context.Context, r region.Region, champ champion.Champion) (*apiclient.Champion, error) {
+func (c *client) GetChampionByID(ctx context.Context, r region.Region, champ champion.Champion) (*apiclient.Champion, error) {
 	var val apiclient.Champion
-	key := fmt.Sprintf("get-champion-by-id:%s:%d", r, champ)
-	t, err := c.d.Get(ctx, key, &val, zeroTime)
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return &val, nil
-	}
-	res, err := c.Client.GetChampionByID(ctx, r, champ)
+	key := methodKey("GetChampionByID", r, champ)
+	err := c.cached(ctx, "GetChampionByID", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetChampionByID(ctx, r, champ)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetChallengerLeague(ctx context.Context, r region.Region, q queue.Queue) (*apiclient.LeagueList, error) {
 	var val apiclient.LeagueList
-	key := fmt.Sprintf("get-challenger-league:%s:%s", r, q)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return &val, nil
+	key := methodKey("GetChallengerLeague", r, q)
+	err := c.cached(ctx, "GetChallengerLeague", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetChallengerLeague(ctx, r, q)
+	})
+	if err != nil {
+		return nil, err
 	}
-	res, err := c.Client.GetChallengerLeague(ctx, r, q)
+	return &val, nil
+}
+
+func (c *client) GetGrandmasterLeague(ctx context.Context, r region.Region, q queue.Queue) (*apiclient.LeagueList, error) {
+	var val apiclient.LeagueList
+	key := methodKey("GetGrandmasterLeague", r, q)
+	err := c.cached(ctx, "GetGrandmasterLeague", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetGrandmasterLeague(ctx, r, q)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetMasterLeague(ctx context.Context, r region.Region, q queue.Queue) (*apiclient.LeagueList, error) {
 	var val apiclient.LeagueList
-	key := fmt.Sprintf("get-master-league:%s:%s", r, q)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return &val, nil
-	}
-	res, err := c.Client.GetMasterLeague(ctx, r, q)
+	key := methodKey("GetMasterLeague", r, q)
+	err := c.cached(ctx, "GetMasterLeague", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetMasterLeague(ctx, r, q)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetAllLeaguePositionsForSummoner(ctx context.Context, r region.Region, summonerID string) ([]apiclient.LeaguePosition, error) {
-	type LeaguePositions struct {
-		Positions []apiclient.LeaguePosition
-	}
-	var val LeaguePositions
-	key := fmt.Sprintf("get-all-league-positions-for-summoner:%s:%s", r, summonerID)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return val.Positions, nil
-	}
-	res, err := c.Client.GetAllLeaguePositionsForSummoner(ctx, r, summonerID)
+	var val leaguePositions
+	key := methodKey("GetAllLeaguePositionsForSummoner", r, summonerID)
+	err := c.cached(ctx, "GetAllLeaguePositionsForSummoner", key, &val, func(ctx context.Context) (interface{}, error) {
+		res, err := c.Client.GetAllLeaguePositionsForSummoner(ctx, r, summonerID)
+		return &leaguePositions{res}, err
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, &LeaguePositions{res}, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return res, err
+	return val.Positions, nil
 }
 
 func (c *client) GetLeagueByID(ctx context.Context, r region.Region, leagueID string) (*apiclient.LeagueList, error) {
 	var val apiclient.LeagueList
-	key := fmt.Sprintf("get-league-by-id:%s:%s", r, leagueID)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return &val, nil
-	}
-	res, err := c.Client.GetLeagueByID(ctx, r, leagueID)
+	key := methodKey("GetLeagueByID", r, leagueID)
+	err := c.cached(ctx, "GetLeagueByID", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetLeagueByID(ctx, r, leagueID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetMatch(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.Match, error) {
-	return c.Client.GetMatch(ctx, r, matchID)
+	var val apiclient.Match
+	key := methodKey("GetMatch", r, matchID)
+	err := c.cached(ctx, "GetMatch", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetMatch(ctx, r, matchID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
 }
 
 func (c *client) GetMatchTimeline(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.MatchTimeline, error) {
-	return c.Client.GetMatchTimeline(ctx, r, matchID)
+	var val apiclient.MatchTimeline
+	key := methodKey("GetMatchTimeline", r, matchID)
+	err := c.cached(ctx, "GetMatchTimeline", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetMatchTimeline(ctx, r, matchID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
 }
 
 // filterMatchlist applies the given options to the matchlist, returning a new
@@ -224,103 +337,180 @@ func filterMatchlist(m *apiclient.Matchlist, opts *apiclient.GetMatchlistOptions
 
 func (c *client) GetMatchlist(ctx context.Context, r region.Region, accountID string, opt *apiclient.GetMatchlistOptions) (*apiclient.Matchlist, error) {
 	var val apiclient.Matchlist
-	key := fmt.Sprintf("get-matchlist:%s:%s", r, accountID)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return filterMatchlist(&val, opt), nil
+	key := methodKey("GetMatchlist", r, accountID)
+	// Cache the unfiltered matchlist, and apply the options locally.
+	err := c.cached(ctx, "GetMatchlist", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetMatchlist(ctx, r, accountID, nil)
+	})
+	if err != nil {
+		return nil, err
 	}
-	res, err := c.Client.GetMatchlist(ctx, r, accountID, nil)
+	return filterMatchlist(&val, opt), nil
+}
+
+// matchIdsKey returns the cache key for GetMatchIds, which includes all
+// options since they are applied by the server.
+func matchIdsKey(r v5region.V5Region, puuid string, opts *apiclient.GetMatchIdsOptions) string {
+	return methodKey("GetMatchIds", append([]interface{}{r, puuid}, matchIdsArgs(opts)...)...)
+}
+
+func (c *client) GetMatchIds(ctx context.Context, r v5region.V5Region, puuid string, opts *apiclient.GetMatchIdsOptions) ([]string, error) {
+	var val matchIds
+	err := c.cached(ctx, "GetMatchIds", matchIdsKey(r, puuid, opts), &val, func(ctx context.Context) (interface{}, error) {
+		res, err := c.Client.GetMatchIds(ctx, r, puuid, opts)
+		return &matchIds{res}, err
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return filterMatchlist(res, opt), err
+	return val.IDs, nil
 }
 
 func (c *client) GetRecentMatchlist(ctx context.Context, r region.Region, accountID string) (*apiclient.Matchlist, error) {
 	var val apiclient.Matchlist
-	key := fmt.Sprintf("get-recent-matchlist:%s:%s", r, accountID)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 1*time.Hour {
-		return &val, nil
-	}
-	res, err := c.Client.GetRecentMatchlist(ctx, r, accountID)
+	key := methodKey("GetRecentMatchlist", r, accountID)
+	err := c.cached(ctx, "GetRecentMatchlist", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetRecentMatchlist(ctx, r, accountID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetFeaturedGames(ctx context.Context, r region.Region) (*apiclient.FeaturedGames, error) {
 	var val apiclient.FeaturedGames
-	key := fmt.Sprintf("get-featured-games:%s", r)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 1*time.Hour {
-		return &val, nil
+	key := methodKey("GetFeaturedGames", r)
+	err := c.cached(ctx, "GetFeaturedGames", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetFeaturedGames(ctx, r)
+	})
+	if err != nil {
+		return nil, err
 	}
-	res, err := c.Client.GetFeaturedGames(ctx, r)
+	return &val, nil
+}
+
+func (c *client) GetCurrentGameInfoBySummoner(ctx context.Context, r region.Region, summonerID string) (*apiclient.CurrentGameInfo, error) {
+	var val apiclient.CurrentGameInfo
+	key := methodKey("GetCurrentGameInfoBySummoner", r, summonerID)
+	err := c.cached(ctx, "GetCurrentGameInfoBySummoner", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetCurrentGameInfoBySummoner(ctx, r, summonerID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetByAccountID(ctx context.Context, r region.Region, accountID string) (*apiclient.Summoner, error) {
 	var val apiclient.Summoner
-	key := fmt.Sprintf("get-by-account-id:%s:%s", r, accountID)
-	_, err := c.d.Get(ctx, key, &val, zeroTime)
-	if err == nil {
-		return &val, nil
-	}
-	res, err := c.Client.GetByAccountID(ctx, r, accountID)
+	key := methodKey("GetByAccountID", r, accountID)
+	err := c.cached(ctx, "GetByAccountID", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetByAccountID(ctx, r, accountID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, zeroTime)
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetBySummonerName(ctx context.Context, r region.Region, name string) (*apiclient.Summoner, error) {
 	var val apiclient.Summoner
-	key := fmt.Sprintf("get-by-summoner-name:%s:%s", r, name)
-	t, err := c.d.Get(ctx, key, &val, time.Now())
-	if err == nil && time.Since(t) < 24*time.Hour {
-		return &val, nil
+	key := methodKey("GetBySummonerName", r, name)
+	err := c.cached(ctx, "GetBySummonerName", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetBySummonerName(ctx, r, name)
+	})
+	if err != nil {
+		return nil, err
 	}
-	res, err := c.Client.GetBySummonerName(ctx, r, name)
+	return &val, nil
+}
+
+func (c *client) GetBySummonerPUUID(ctx context.Context, r region.Region, puuid string) (*apiclient.Summoner, error) {
+	var val apiclient.Summoner
+	key := methodKey("GetBySummonerPUUID", r, puuid)
+	err := c.cached(ctx, "GetBySummonerPUUID", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetBySummonerPUUID(ctx, r, puuid)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, time.Now())
-	go c.d.Purge(ctx, key, 1)
-	return res, err
+	return &val, nil
 }
 
 func (c *client) GetBySummonerID(ctx context.Context, r region.Region, summonerID string) (*apiclient.Summoner, error) {
 	var val apiclient.Summoner
-	key := fmt.Sprintf("get-by-summoner-id:%s:%s", r, summonerID)
-	_, err := c.d.Get(ctx, key, &val, zeroTime)
-	if err == nil {
-		return &val, nil
+	key := methodKey("GetBySummonerID", r, summonerID)
+	err := c.cached(ctx, "GetBySummonerID", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetBySummonerID(ctx, r, summonerID)
+	})
+	if err != nil {
+		return nil, err
 	}
-	res, err := c.Client.GetBySummonerID(ctx, r, summonerID)
+	return &val, nil
+}
+
+func (c *client) GetRiotAccountByNameAndTag(ctx context.Context, r v5region.V5Region, name string, tag string) (*apiclient.RiotAccount, error) {
+	var val apiclient.RiotAccount
+	key := methodKey("GetRiotAccountByNameAndTag", r, name, tag)
+	err := c.cached(ctx, "GetRiotAccountByNameAndTag", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetRiotAccountByNameAndTag(ctx, r, name, tag)
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = c.d.Put(ctx, key, res, zeroTime)
-	return res, err
+	return &val, nil
 }
 
-// New returns a cached client, using the underlying client to query non-cached
-// values, and the underlying datastore as the cache location.
-func New(c apiclient.Client, d Datastore) apiclient.Client {
-	return &client{
-		Client: c,
-		d:      d,
+func (c *client) GetRiotAccountByPuuid(ctx context.Context, r v5region.V5Region, puuid string) (*apiclient.RiotAccount, error) {
+	var val apiclient.RiotAccount
+	key := methodKey("GetRiotAccountByPuuid", r, puuid)
+	err := c.cached(ctx, "GetRiotAccountByPuuid", key, &val, func(ctx context.Context) (interface{}, error) {
+		return c.Client.GetRiotAccountByPuuid(ctx, r, puuid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
+
+func (c *client) GetThirdPartyCodeByID(ctx context.Context, r region.Region, summonerID string) (string, error) {
+	var val thirdPartyCode
+	key := methodKey("GetThirdPartyCodeByID", r, summonerID)
+	err := c.cached(ctx, "GetThirdPartyCodeByID", key, &val, func(ctx context.Context) (interface{}, error) {
+		res, err := c.Client.GetThirdPartyCodeByID(ctx, r, summonerID)
+		return &thirdPartyCode{res}, err
+	})
+	if err != nil {
+		return "", err
 	}
+	return val.Code, nil
+}
+
+func (c *client) Close() error {
+	c.janitor.close()
+	return nil
+}
+
+// New returns a cached client, using the underlying client to query non-cached
+// values, and the underlying datastore as the cache location. Every Client
+// method is cached according to its default policy unless overridden by the
+// given options. Call Close when the client is no longer needed.
+func New(c apiclient.Client, d Datastore, opts ...Option) Client {
+	res := &client{
+		Client:      c,
+		d:           d,
+		policies:    make(map[string]Policy),
+		refreshing:  make(map[string]bool),
+		stats:       make(map[string]*Stats),
+		janitor:     newJanitor(d),
+		notFoundTTL: DefaultNotFoundTTL,
+	}
+	for method, p := range defaultPolicies {
+		res.policies[method] = p
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
 }
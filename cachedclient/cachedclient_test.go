@@ -0,0 +1,350 @@
+package cachedclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/champion"
+	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
+)
+
+// mapDatastore is a minimal in-memory Datastore that keeps the most recent
+// value per key.
+type mapDatastore struct {
+	lock sync.Mutex
+	vals map[string][]byte
+	ts   map[string]time.Time
+}
+
+func newMapDatastore() *mapDatastore {
+	return &mapDatastore{
+		vals: make(map[string][]byte),
+		ts:   make(map[string]time.Time),
+	}
+}
+
+func (m *mapDatastore) Get(ctx context.Context, key string, dest interface{}, t time.Time) (time.Time, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	b, ok := m.vals[key]
+	if !ok {
+		return zeroTime, fmt.Errorf("key %q is missing", key)
+	}
+	return m.ts[key], json.Unmarshal(b, dest)
+}
+
+func (m *mapDatastore) Put(ctx context.Context, key string, val interface{}, t time.Time) error {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.vals[key] = b
+	m.ts[key] = t
+	return nil
+}
+
+func (m *mapDatastore) Purge(ctx context.Context, key string, keep int) error {
+	if keep > 0 {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.vals, key)
+	delete(m.ts, key)
+	return nil
+}
+
+func (m *mapDatastore) PurgePrefix(ctx context.Context, prefix string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key := range m.vals {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.vals, key)
+			delete(m.ts, key)
+		}
+	}
+	return nil
+}
+
+// countingClient counts calls to the methods used in tests.
+type countingClient struct {
+	apiclient.Client
+
+	// block, if non-nil, delays GetMatch until it is closed.
+	block chan struct{}
+
+	// err, if non-nil, is returned by GetChampionByID.
+	err error
+
+	lock  sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingClient) count(method string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.calls[method]
+}
+
+func (c *countingClient) called(method string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls[method]++
+}
+
+func (c *countingClient) GetMatch(ctx context.Context, r v5region.V5Region, matchID string) (*apiclient.Match, error) {
+	c.called("GetMatch")
+	if c.block != nil {
+		<-c.block
+	}
+	var m apiclient.Match
+	m.Metadata.MatchID = matchID
+	return &m, nil
+}
+
+func (c *countingClient) GetChampionByID(ctx context.Context, r region.Region, champ champion.Champion) (*apiclient.Champion, error) {
+	c.called("GetChampionByID")
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &apiclient.Champion{ID: int64(champ)}, nil
+}
+
+func (c *countingClient) GetThirdPartyCodeByID(ctx context.Context, r region.Region, summonerID string) (string, error) {
+	c.called("GetThirdPartyCodeByID")
+	return "code", nil
+}
+
+func TestDefaultPoliciesCoverClient(t *testing.T) {
+	typ := reflect.TypeOf((*apiclient.Client)(nil)).Elem()
+	for i := 0; i < typ.NumMethod(); i++ {
+		name := typ.Method(i).Name
+		if _, ok := defaultPolicies[name]; !ok {
+			t.Errorf("no default policy for %s", name)
+		}
+		if _, ok := methods[name]; !ok {
+			t.Errorf("no cache keys for %s", name)
+		}
+	}
+	if len(defaultPolicies) != typ.NumMethod() {
+		t.Errorf("got %d default policies for %d methods", len(defaultPolicies), typ.NumMethod())
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+	under := &countingClient{calls: make(map[string]int)}
+	c := New(under, newMapDatastore(), WithPolicy("GetChampionByID", TTL(time.Nanosecond)))
+
+	for i := 0; i < 3; i++ {
+		m, err := c.GetMatch(ctx, v5region.Americas, "NA1_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Metadata.MatchID != "NA1_1" {
+			t.Errorf("got match %q, want NA1_1", m.Metadata.MatchID)
+		}
+		if _, err := c.GetChampionByID(ctx, region.NA1, champion.Ashe); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetThirdPartyCodeByID(ctx, region.NA1, "id"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Matches are immutable, the champion TTL expires immediately, and third
+	// party codes are never cached.
+	for method, want := range map[string]int{
+		"GetMatch":              1,
+		"GetChampionByID":       3,
+		"GetThirdPartyCodeByID": 3,
+	} {
+		if got := under.count(method); got != want {
+			t.Errorf("got %d calls to %s, want %d", got, method, want)
+		}
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	ctx := context.Background()
+	under := &countingClient{
+		block: make(chan struct{}),
+		calls: make(map[string]int),
+	}
+	c := New(under, newMapDatastore()).(*client)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := c.GetMatch(ctx, v5region.Americas, "NA1_1")
+			if err != nil {
+				t.Error(err)
+			} else if m.Metadata.MatchID != "NA1_1" {
+				t.Errorf("got match %q, want NA1_1", m.Metadata.MatchID)
+			}
+		}()
+	}
+
+	// Release the upstream call once all other callers are waiting for it.
+	for {
+		c.flight.lock.Lock()
+		call, ok := c.flight.calls["get-match:AMERICAS:NA1_1"]
+		waiting := ok && call.dups == callers-1
+		c.flight.lock.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(under.block)
+	wg.Wait()
+
+	if got := under.count("GetMatch"); got != 1 {
+		t.Errorf("got %d calls to GetMatch, want 1", got)
+	}
+	if got, want := c.Stats()["GetMatch"], (Stats{Misses: 1, Coalesced: callers - 1}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
+
+func TestStale(t *testing.T) {
+	ctx := context.Background()
+	d := newMapDatastore()
+	under := &countingClient{calls: make(map[string]int)}
+	c := New(under, d, WithPolicy("GetChampionByID", Policy{
+		TTL:                  time.Hour,
+		StaleWhileRevalidate: time.Hour,
+		StaleIfError:         24 * time.Hour,
+	}))
+	key := fmt.Sprintf("get-champion-by-id:%s:%d", region.NA1, champion.Ashe)
+	written := time.Now().Add(-90 * time.Minute)
+	d.Put(ctx, key, &apiclient.Champion{ID: 1}, written)
+
+	// Within the revalidation window, the stale value is returned immediately
+	// and refreshed in the background.
+	var res Result
+	got, err := c.GetChampionByID(WithResult(ctx, &res), region.NA1, champion.Ashe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 1 || !res.Cached || !res.Stale || !res.Time.Equal(written) {
+		t.Errorf("got champion %d with result %+v, want stale champion 1", got.ID, res)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var v apiclient.Champion
+		if d.Get(ctx, key, &v, time.Now()); v.ID == int64(champion.Ashe) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale value was not revalidated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Beyond the revalidation window, upstream errors fall back to the stale
+	// value.
+	written = time.Now().Add(-3 * time.Hour)
+	d.Put(ctx, key, &apiclient.Champion{ID: 1}, written)
+	under.err = apiclient.ErrServiceUnavailable
+	got, err = c.GetChampionByID(WithResult(ctx, &res), region.NA1, champion.Ashe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 1 || !res.Stale || res.Err != apiclient.ErrServiceUnavailable {
+		t.Errorf("got champion %d with result %+v, want stale champion 1 with error", got.ID, res)
+	}
+
+	// Missing data is not masked by stale values.
+	under.err = apiclient.ErrDataNotFound
+	if _, err := c.GetChampionByID(ctx, region.NA1, champion.Ashe); err != apiclient.ErrDataNotFound {
+		t.Errorf("got error %v, want %v", err, apiclient.ErrDataNotFound)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		opts []Option
+		want int
+	}{
+		{nil, 1},
+		{[]Option{WithNotFoundTTL(0)}, 3},
+		{[]Option{WithPolicy("GetChampionByID", Policy{TTL: time.Hour, NotFoundTTL: -1})}, 3},
+	} {
+		under := &countingClient{
+			err:   apiclient.ErrDataNotFound,
+			calls: make(map[string]int),
+		}
+		c := New(under, newMapDatastore(), tc.opts...)
+		for i := 0; i < 3; i++ {
+			if _, err := c.GetChampionByID(ctx, region.NA1, champion.Ashe); err != apiclient.ErrDataNotFound {
+				t.Errorf("got error %v, want %v", err, apiclient.ErrDataNotFound)
+			}
+		}
+		if got := under.count("GetChampionByID"); got != tc.want {
+			t.Errorf("got %d calls with %d options, want %d", got, len(tc.opts), tc.want)
+		}
+	}
+}
+
+func TestStatsAndInvalidate(t *testing.T) {
+	ctx := context.Background()
+	under := &countingClient{calls: make(map[string]int)}
+	c := New(under, newMapDatastore())
+
+	for _, id := range []string{"NA1_1", "NA1_1", "NA1_2"} {
+		if _, err := c.GetMatch(ctx, v5region.Americas, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := c.Stats()["GetMatch"], (Stats{Hits: 1, Misses: 2}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+
+	e, err := c.Inspect(ctx, "GetMatch", v5region.Americas, "NA1_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Key != "get-match:AMERICAS:NA1_1" || e.Size == 0 || !e.Fresh {
+		t.Errorf("got entry %+v", e)
+	}
+	if _, err := c.Inspect(ctx, "GetMatch", v5region.Americas, "NA1_3"); err != ErrNotCached {
+		t.Errorf("got %v for a missing entry, want ErrNotCached", err)
+	}
+	if _, err := c.Inspect(ctx, "GetMatch", v5region.Americas, 1); err == nil {
+		t.Error("got no error for a bad argument")
+	}
+
+	if err := c.Invalidate(ctx, "GetMatch", v5region.Americas, "NA1_1"); err != nil {
+		t.Fatal(err)
+	}
+	c.GetMatch(ctx, v5region.Americas, "NA1_1")
+	c.GetMatch(ctx, v5region.Americas, "NA1_2")
+	if got := under.count("GetMatch"); got != 3 {
+		t.Errorf("got %d calls after invalidating one match, want 3", got)
+	}
+
+	// Invalidating by region removes every match.
+	if err := c.Invalidate(ctx, "GetMatch", v5region.Americas); err != nil {
+		t.Fatal(err)
+	}
+	c.GetMatch(ctx, v5region.Americas, "NA1_1")
+	c.GetMatch(ctx, v5region.Americas, "NA1_2")
+	if got := under.count("GetMatch"); got != 5 {
+		t.Errorf("got %d calls after invalidating all matches, want 5", got)
+	}
+}
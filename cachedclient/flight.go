@@ -0,0 +1,84 @@
+package cachedclient
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// call is an in-flight or completed flight.do call.
+type call struct {
+	done chan struct{}
+
+	// dups is the number of callers waiting for the result, protected by the
+	// flight lock.
+	dups int
+
+	// val is the JSON-encoded value shared with waiting callers, and res and
+	// err are returned to them.
+	val []byte
+	res Result
+	err error
+}
+
+// flight coalesces concurrent calls with the same key, so that only one of
+// them does the work and the others share its result.
+type flight struct {
+	lock  sync.Mutex
+	calls map[string]*call
+}
+
+// isContextError returns true if the error is due to context cancellation.
+func isContextError(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// do calls f, which must fill val, unless a call with the same key is already
+// in progress. In that case, do waits for that call and fills val with a copy
+// of its result, marked as coalesced. If the call in progress fails because its caller's context
+// was cancelled, then do tries again with the current context.
+func (g *flight) do(ctx context.Context, key string, val interface{}, f func() (Result, error)) (Result, error) {
+	for {
+		g.lock.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*call)
+		}
+		if c, ok := g.calls[key]; ok {
+			c.dups++
+			g.lock.Unlock()
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return Result{Coalesced: true}, ctx.Err()
+			}
+			if c.err != nil {
+				if isContextError(c.err) && ctx.Err() == nil {
+					continue
+				}
+				return Result{Coalesced: true}, c.err
+			}
+			res := c.res
+			res.Coalesced = true
+			return res, json.Unmarshal(c.val, val)
+		}
+		c := &call{done: make(chan struct{})}
+		g.calls[key] = c
+		g.lock.Unlock()
+
+		res, err := f()
+
+		g.lock.Lock()
+		delete(g.calls, key)
+		dups := c.dups
+		g.lock.Unlock()
+
+		// Callers that arrive after the delete start a new call, so only the
+		// ones counted so far need a copy of the result.
+		c.res, c.err = res, err
+		if err == nil && dups > 0 {
+			c.val, c.err = json.Marshal(val)
+		}
+		close(c.done)
+		return res, err
+	}
+}
@@ -76,7 +76,54 @@ func (g *googleDatastore) Purge(ctx context.Context, key string, keep int) error
 	return nil
 }
 
-func NewDatastore(ctx context.Context, project, namespace string) (cachedclient.Datastore, error) {
+func (g *googleDatastore) PurgePrefix(ctx context.Context, prefix string) error {
+	// Each key is stored as a kind, so list the kinds in the prefix range.
+	start := datastore.NameKey("__kind__", prefix, nil)
+	start.Namespace = g.namespace
+	end := datastore.NameKey("__kind__", prefix+"\uffff", nil)
+	end.Namespace = g.namespace
+	query := datastore.NewQuery("__kind__").Namespace(g.namespace).Filter("__key__ >=", start).Filter("__key__ <", end).KeysOnly()
+	kinds, err := g.client.GetAll(ctx, query, nil)
+	if err != nil {
+		return err
+	}
+	for _, k := range kinds {
+		if err := g.Purge(ctx, k.Name, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *googleDatastore) Versions(ctx context.Context, key string, start, end time.Time) ([]time.Time, error) {
+	// IDs decrease as time increases, and the zero time has the largest ID.
+	startKey := datastore.Key{
+		Kind:      key,
+		ID:        int64(terminalTime.Sub(start).Seconds()),
+		Namespace: g.namespace,
+	}
+	endKey := datastore.Key{
+		Kind:      key,
+		ID:        int64(terminalTime.Sub(end).Seconds()),
+		Namespace: g.namespace,
+	}
+	zeroID := int64(terminalTime.Sub(zeroTime).Seconds())
+	query := datastore.NewQuery(key).Namespace(g.namespace).Filter("__key__ >=", &endKey).Filter("__key__ <=", &startKey).Order("-__key__").KeysOnly()
+	keys, err := g.client.GetAll(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res []time.Time
+	for _, k := range keys {
+		if k.ID == zeroID {
+			continue
+		}
+		res = append(res, time.Unix(terminalTime.Unix()-k.ID, 0))
+	}
+	return res, nil
+}
+
+func NewDatastore(ctx context.Context, project, namespace string) (cachedclient.HistoryDatastore, error) {
 	ds, err := datastore.NewClient(ctx, project)
 	if err != nil {
 		return nil, err
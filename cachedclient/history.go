@@ -0,0 +1,136 @@
+package cachedclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+)
+
+// HistoryDatastore is a Datastore that can list the versions stored for a
+// key. Datastores that do not implement it are queried one version at a time
+// with Get.
+type HistoryDatastore interface {
+	Datastore
+
+	// Versions returns the times of the values stored for the given key
+	// between start and end inclusive, in ascending order. Values written with
+	// the zero time are not included.
+	Versions(ctx context.Context, key string, start, end time.Time) ([]time.Time, error)
+}
+
+// HistoryClient returns the results that a cached client has stored over time.
+// Only methods whose Policy keeps history retain more than the most recent
+// result.
+type HistoryClient interface {
+	ChallengerLeague(ctx context.Context, r region.Region, q queue.Queue, start, end time.Time) ([]LeagueListSnapshot, error)
+	GrandmasterLeague(ctx context.Context, r region.Region, q queue.Queue, start, end time.Time) ([]LeagueListSnapshot, error)
+	MasterLeague(ctx context.Context, r region.Region, q queue.Queue, start, end time.Time) ([]LeagueListSnapshot, error)
+	LeagueByID(ctx context.Context, r region.Region, leagueID string, start, end time.Time) ([]LeagueListSnapshot, error)
+	LeaguePositions(ctx context.Context, r region.Region, summonerID string, start, end time.Time) ([]LeaguePositionsSnapshot, error)
+}
+
+// LeagueListSnapshot is a league as it was observed at the given time.
+type LeagueListSnapshot struct {
+	Time   time.Time
+	League *apiclient.LeagueList
+}
+
+// LeaguePositionsSnapshot is a summoner's league positions as they were
+// observed at the given time.
+type LeaguePositionsSnapshot struct {
+	Time      time.Time
+	Positions []apiclient.LeaguePosition
+}
+
+type history struct {
+	d Datastore
+}
+
+// versions returns the times of the values stored for the key between start
+// and end, in ascending order.
+func (h *history) versions(ctx context.Context, key string, start, end time.Time, dest interface{}) ([]time.Time, error) {
+	if hd, ok := h.d.(HistoryDatastore); ok {
+		return hd.Versions(ctx, key, start, end)
+	}
+	// Walk backwards from end, asking for the version before the last one
+	// found until one is older than start.
+	var res []time.Time
+	for t := end; !t.Before(start); {
+		got, err := h.d.Get(ctx, key, dest, t)
+		if err != nil || got.IsZero() || got.After(t) || got.Before(start) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			break
+		}
+		res = append(res, got)
+		t = got.Add(-time.Nanosecond)
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, nil
+}
+
+// snapshots calls f with each version of the key between start and end, in
+// ascending order. newVal returns a value to decode into.
+func (h *history) snapshots(ctx context.Context, key string, start, end time.Time, newVal func() interface{}, f func(t time.Time, val interface{})) error {
+	times, err := h.versions(ctx, key, start, end, newVal())
+	if err != nil {
+		return err
+	}
+	for _, t := range times {
+		val := newVal()
+		if _, err := h.d.Get(ctx, key, val, t); err != nil {
+			return err
+		}
+		f(t, val)
+	}
+	return nil
+}
+
+func (h *history) leagueList(ctx context.Context, key string, start, end time.Time) ([]LeagueListSnapshot, error) {
+	var res []LeagueListSnapshot
+	err := h.snapshots(ctx, key, start, end, func() interface{} {
+		return &apiclient.LeagueList{}
+	}, func(t time.Time, val interface{}) {
+		res = append(res, LeagueListSnapshot{t, val.(*apiclient.LeagueList)})
+	})
+	return res, err
+}
+
+func (h *history) ChallengerLeague(ctx context.Context, r region.Region, q queue.Queue, start, end time.Time) ([]LeagueListSnapshot, error) {
+	return h.leagueList(ctx, methodKey("GetChallengerLeague", r, q), start, end)
+}
+
+func (h *history) GrandmasterLeague(ctx context.Context, r region.Region, q queue.Queue, start, end time.Time) ([]LeagueListSnapshot, error) {
+	return h.leagueList(ctx, methodKey("GetGrandmasterLeague", r, q), start, end)
+}
+
+func (h *history) MasterLeague(ctx context.Context, r region.Region, q queue.Queue, start, end time.Time) ([]LeagueListSnapshot, error) {
+	return h.leagueList(ctx, methodKey("GetMasterLeague", r, q), start, end)
+}
+
+func (h *history) LeagueByID(ctx context.Context, r region.Region, leagueID string, start, end time.Time) ([]LeagueListSnapshot, error) {
+	return h.leagueList(ctx, methodKey("GetLeagueByID", r, leagueID), start, end)
+}
+
+func (h *history) LeaguePositions(ctx context.Context, r region.Region, summonerID string, start, end time.Time) ([]LeaguePositionsSnapshot, error) {
+	var res []LeaguePositionsSnapshot
+	err := h.snapshots(ctx, methodKey("GetAllLeaguePositionsForSummoner", r, summonerID), start, end, func() interface{} {
+		return &leaguePositions{}
+	}, func(t time.Time, val interface{}) {
+		res = append(res, LeaguePositionsSnapshot{t, val.(*leaguePositions).Positions})
+	})
+	return res, err
+}
+
+// NewHistoryClient returns a HistoryClient that reads the results stored in
+// the Datastore by a cached client. Datastores that implement HistoryDatastore
+// are queried more efficiently.
+func NewHistoryClient(d Datastore) HistoryClient {
+	return &history{d: d}
+}
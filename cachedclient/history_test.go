@@ -0,0 +1,52 @@
+package cachedclient_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+	"github.com/Tilo-K/riot/cachedclient"
+	"github.com/Tilo-K/riot/cachedclient/memory"
+	"github.com/Tilo-K/riot/constants/queue"
+	"github.com/Tilo-K/riot/constants/region"
+)
+
+// getOnly hides the Versions method of a HistoryDatastore.
+type getOnly struct {
+	cachedclient.Datastore
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.NewDatastore()
+	// Keys match the ones written by the cached client.
+	key := fmt.Sprintf("get-challenger-league:%s:%s", region.NA1, queue.RankedSolo5x5)
+	mem.Put(ctx, key, apiclient.LeagueList{Name: "zero"}, time.Time{})
+	for i := 1; i <= 4; i++ {
+		mem.Put(ctx, key, apiclient.LeagueList{Name: fmt.Sprint(i)}, time.Unix(int64(i*100), 0))
+	}
+
+	for _, d := range []cachedclient.Datastore{mem, getOnly{mem}} {
+		h := cachedclient.NewHistoryClient(d)
+		got, err := h.ChallengerLeague(ctx, region.NA1, queue.RankedSolo5x5, time.Unix(150, 0), time.Unix(400, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"2", "3", "4"}
+		if len(got) != len(want) {
+			t.Fatalf("%T: got %d snapshots, want %d", d, len(got), len(want))
+		}
+		for i, s := range got {
+			if s.League.Name != want[i] || !s.Time.Equal(time.Unix(int64((i+2)*100), 0)) {
+				t.Errorf("%T: snapshot %d = %q at %v, want %q", d, i, s.League.Name, s.Time, want[i])
+			}
+		}
+
+		got, err = h.ChallengerLeague(ctx, region.NA1, queue.RankedSolo5x5, time.Unix(0, 0), time.Unix(50, 0))
+		if err != nil || len(got) != 0 {
+			t.Errorf("%T: got %v, %v before the first version, want none", d, got, err)
+		}
+	}
+}
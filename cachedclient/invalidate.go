@@ -0,0 +1,97 @@
+package cachedclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotCached is returned by Inspect if no result is cached for the call.
+var ErrNotCached = errors.New("not cached")
+
+// Entry describes a cached result.
+type Entry struct {
+	// Key is the cache key of the result.
+	Key string
+
+	// Time is when the result was written. It is zero for results that never
+	// expire.
+	Time time.Time
+
+	// Age is how long ago the result was written, and Fresh is true if it is
+	// younger than the TTL of the method.
+	Age   time.Duration
+	Fresh bool
+
+	// Size is the size of the JSON-encoded result.
+	Size int
+
+	// NotFound is true if the cached result is that the data does not exist.
+	NotFound bool
+}
+
+func (c *client) Inspect(ctx context.Context, method string, args ...interface{}) (*Entry, error) {
+	key, prefix, err := lookupKey(method, args)
+	if err != nil {
+		return nil, err
+	}
+	if prefix {
+		return nil, errors.New("cachedclient: Inspect requires all key arguments")
+	}
+	p := c.policy(method)
+	t := zeroTime
+	if p.TTL > 0 {
+		t = time.Now()
+	}
+	val := methods[method].newValue()
+	got, err := c.d.Get(ctx, key, val, t)
+	if err != nil {
+		return c.inspectNotFound(ctx, p, key)
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Key: key, Time: got, Size: len(b), Fresh: true}
+	if !got.IsZero() {
+		e.Age = time.Since(got)
+		e.Fresh = p.TTL == 0 || e.Age < p.TTL
+	}
+	return e, nil
+}
+
+// inspectNotFound returns the cached not-found result for the key, if any.
+func (c *client) inspectNotFound(ctx context.Context, p Policy, key string) (*Entry, error) {
+	if p.NotFoundTTL <= 0 {
+		return nil, ErrNotCached
+	}
+	fresh, exists, t := c.checkNotFound(ctx, p, key)
+	if !exists {
+		return nil, ErrNotCached
+	}
+	return &Entry{
+		Key:      key,
+		Time:     t,
+		Age:      time.Since(t),
+		Fresh:    fresh,
+		NotFound: true,
+	}, nil
+}
+
+func (c *client) Invalidate(ctx context.Context, method string, args ...interface{}) error {
+	key, prefix, err := lookupKey(method, args)
+	if err != nil {
+		return err
+	}
+	if prefix {
+		if err := c.d.PurgePrefix(ctx, key); err != nil {
+			return err
+		}
+		return c.d.PurgePrefix(ctx, notFoundKey(key))
+	}
+	if err := c.d.Purge(ctx, key, 0); err != nil {
+		return err
+	}
+	return c.d.Purge(ctx, notFoundKey(key), 0)
+}
@@ -0,0 +1,136 @@
+package cachedclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// janitorWorkers is the number of purges run concurrently.
+	janitorWorkers = 4
+
+	// janitorQueueSize is the maximum number of keys waiting to be purged.
+	// Requests beyond it are dropped, since the next write to the key
+	// requests another purge.
+	janitorQueueSize = 10000
+
+	// purgeTimeout bounds a single call to Datastore.Purge.
+	purgeTimeout = time.Minute
+
+	// purgeAttempts is the number of times a failed purge is tried, waiting
+	// purgeRetryDelay after the first failure and doubling after each one.
+	purgeAttempts   = 3
+	purgeRetryDelay = time.Second
+)
+
+// purgeRequest is a pending purge of a key.
+type purgeRequest struct {
+	keep     int
+	attempts int
+}
+
+// janitor purges old values from the Datastore in the background. Requests for
+// the same key are merged while they wait, so a key written many times is
+// only purged once.
+type janitor struct {
+	d Datastore
+
+	// lock protects pending and closed, and sends to queue.
+	lock    sync.Mutex
+	pending map[string]*purgeRequest
+	closed  bool
+	queue   chan string
+
+	wg sync.WaitGroup
+}
+
+func newJanitor(d Datastore) *janitor {
+	j := &janitor{
+		d:       d,
+		pending: make(map[string]*purgeRequest),
+		queue:   make(chan string, janitorQueueSize),
+	}
+	j.wg.Add(janitorWorkers)
+	for i := 0; i < janitorWorkers; i++ {
+		go j.work()
+	}
+	return j
+}
+
+// purge requests that all but the most recent keep values for the key are
+// removed. If a purge of the key is already waiting, then its keep is
+// replaced, since the latest request reflects the latest write.
+func (j *janitor) purge(key string, keep int) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if r, ok := j.pending[key]; ok {
+		r.keep = keep
+		return
+	}
+	j.enqueue(key, &purgeRequest{keep: keep})
+}
+
+// enqueue adds the request to the queue unless the janitor is closed or the
+// queue is full. It must be called with the lock held.
+func (j *janitor) enqueue(key string, r *purgeRequest) {
+	if j.closed {
+		return
+	}
+	select {
+	case j.queue <- key:
+		j.pending[key] = r
+	default:
+	}
+}
+
+// work runs purges until the queue is closed and empty.
+func (j *janitor) work() {
+	defer j.wg.Done()
+	for key := range j.queue {
+		j.lock.Lock()
+		r := j.pending[key]
+		delete(j.pending, key)
+		j.lock.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+		err := j.d.Purge(ctx, key, r.keep)
+		cancel()
+		if err != nil {
+			j.retry(key, r)
+		}
+	}
+}
+
+// retry enqueues a failed request again after a delay, unless it has used all
+// of its attempts.
+func (j *janitor) retry(key string, r *purgeRequest) {
+	r.attempts++
+	if r.attempts >= purgeAttempts {
+		return
+	}
+	delay := purgeRetryDelay << uint(r.attempts-1)
+	time.AfterFunc(delay, func() {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		if _, ok := j.pending[key]; ok {
+			// A newer request is already waiting.
+			return
+		}
+		j.enqueue(key, r)
+	})
+}
+
+// close stops accepting requests, and waits for the queued purges to finish.
+// Failed purges are not retried after close.
+func (j *janitor) close() {
+	j.lock.Lock()
+	if j.closed {
+		j.lock.Unlock()
+		return
+	}
+	j.closed = true
+	close(j.queue)
+	j.lock.Unlock()
+	j.wg.Wait()
+}
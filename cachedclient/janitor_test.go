@@ -0,0 +1,78 @@
+package cachedclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// purgeDatastore records purges, blocking each one until released.
+type purgeDatastore struct {
+	*mapDatastore
+	started chan string
+	release chan struct{}
+
+	lock   sync.Mutex
+	purges map[string][]int
+	fail   map[string]int
+}
+
+func (p *purgeDatastore) Purge(ctx context.Context, key string, keep int) error {
+	p.started <- key
+	<-p.release
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.purges[key] = append(p.purges[key], keep)
+	if p.fail[key] > 0 {
+		p.fail[key]--
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func TestJanitor(t *testing.T) {
+	d := &purgeDatastore{
+		mapDatastore: newMapDatastore(),
+		started:      make(chan string, 100),
+		release:      make(chan struct{}),
+		purges:       make(map[string][]int),
+		fail:         map[string]int{"fail": 1},
+	}
+	j := newJanitor(d)
+
+	// Occupy every worker, so that later requests wait in the queue.
+	j.purge("fail", 1)
+	for _, key := range []string{"a", "b", "c"} {
+		j.purge(key, 1)
+	}
+	for i := 0; i < janitorWorkers; i++ {
+		<-d.started
+	}
+	for i := 0; i < 100; i++ {
+		j.purge("k", 1)
+	}
+	j.purge("k", 0)
+	close(d.release)
+
+	// Wait for the retry before closing.
+	for key := range d.started {
+		if key == "fail" {
+			break
+		}
+	}
+	j.close()
+	j.purge("after", 1)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if got := d.purges["k"]; len(got) != 1 || got[0] != 0 {
+		t.Errorf("got purges %v of k, want one keeping 0", got)
+	}
+	if got := len(d.purges["fail"]); got != 2 {
+		t.Errorf("got %d purges of a failing key, want 2", got)
+	}
+	if _, ok := d.purges["after"]; ok {
+		t.Error("got purge requested after close")
+	}
+}
@@ -0,0 +1,127 @@
+package cachedclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+)
+
+// Wrappers for results that are not structs, since Datastore values must be
+// structs.
+type (
+	championMasteries struct {
+		Masteries []apiclient.ChampionMastery
+	}
+	championMasteryScore struct {
+		Score int
+	}
+	leaguePositions struct {
+		Positions []apiclient.LeaguePosition
+	}
+	matchIds struct {
+		IDs []string
+	}
+	thirdPartyCode struct {
+		Code string
+	}
+)
+
+// methodKeys describes how the results of a cached method are stored.
+type methodKeys struct {
+	// format is the format of the cache key, applied to the arguments of the
+	// method in order.
+	format string
+
+	// newValue returns a pointer to the type stored in the Datastore.
+	newValue func() interface{}
+}
+
+// methods maps each cached Client method name to its keys. Methods that take
+// options include only the options that are applied by the server.
+var methods = map[string]methodKeys{
+	"GetAllChampionMasteries":          {"get-all-champion-masteries:%s:%s", func() interface{} { return &championMasteries{} }},
+	"GetAllChampionMasteriesByPuuid":   {"get-all-champion-masteries-by-puuid:%s:%s", func() interface{} { return &championMasteries{} }},
+	"GetChampionMastery":               {"get-champion-mastery:%s:%s:%d", func() interface{} { return &apiclient.ChampionMastery{} }},
+	"GetChampionMasteryScore":          {"get-champion-mastery-score:%s:%s", func() interface{} { return &championMasteryScore{} }},
+	"GetChampions":                     {"get-champions:%s", func() interface{} { return &apiclient.ChampionList{} }},
+	"GetChampionByID":                  {"get-champion-by-id:%s:%d", func() interface{} { return &apiclient.Champion{} }},
+	"GetChallengerLeague":              {"get-challenger-league:%s:%s", func() interface{} { return &apiclient.LeagueList{} }},
+	"GetGrandmasterLeague":             {"get-grandmaster-league:%s:%s", func() interface{} { return &apiclient.LeagueList{} }},
+	"GetMasterLeague":                  {"get-master-league:%s:%s", func() interface{} { return &apiclient.LeagueList{} }},
+	"GetAllLeaguePositionsForSummoner": {"get-all-league-positions-for-summoner:%s:%s", func() interface{} { return &leaguePositions{} }},
+	"GetLeagueByID":                    {"get-league-by-id:%s:%s", func() interface{} { return &apiclient.LeagueList{} }},
+	"GetMatch":                         {"get-match:%s:%s", func() interface{} { return &apiclient.Match{} }},
+	"GetMatchTimeline":                 {"get-match-timeline:%s:%s", func() interface{} { return &apiclient.MatchTimeline{} }},
+	"GetMatchlist":                     {"get-matchlist:%s:%s", func() interface{} { return &apiclient.Matchlist{} }},
+	"GetMatchIds":                      {"get-match-ids:%s:%s:%d:%d:%d:%s:%d:%d", func() interface{} { return &matchIds{} }},
+	"GetRecentMatchlist":               {"get-recent-matchlist:%s:%s", func() interface{} { return &apiclient.Matchlist{} }},
+	"GetFeaturedGames":                 {"get-featured-games:%s", func() interface{} { return &apiclient.FeaturedGames{} }},
+	"GetCurrentGameInfoBySummoner":     {"get-current-game-info-by-summoner:%s:%s", func() interface{} { return &apiclient.CurrentGameInfo{} }},
+	"GetByAccountID":                   {"get-by-account-id:%s:%s", func() interface{} { return &apiclient.Summoner{} }},
+	"GetBySummonerName":                {"get-by-summoner-name:%s:%s", func() interface{} { return &apiclient.Summoner{} }},
+	"GetBySummonerPUUID":               {"get-by-summoner-puuid:%s:%s", func() interface{} { return &apiclient.Summoner{} }},
+	"GetBySummonerID":                  {"get-by-summoner-id:%s:%s", func() interface{} { return &apiclient.Summoner{} }},
+	"GetRiotAccountByNameAndTag":       {"get-riot-account-by-name-and-tag:%s:%s:%s", func() interface{} { return &apiclient.RiotAccount{} }},
+	"GetRiotAccountByPuuid":            {"get-riot-account-by-puuid:%s:%s", func() interface{} { return &apiclient.RiotAccount{} }},
+	"GetThirdPartyCodeByID":            {"get-third-party-code-by-id:%s:%s", func() interface{} { return &thirdPartyCode{} }},
+}
+
+// methodKey returns the cache key for a call to the method with the given
+// arguments.
+func methodKey(method string, args ...interface{}) string {
+	return fmt.Sprintf(methods[method].format, args...)
+}
+
+// keyArgs expands the arguments given to Inspect or Invalidate into the
+// arguments of the key format.
+func keyArgs(method string, args []interface{}) []interface{} {
+	if method != "GetMatchIds" || len(args) != 3 {
+		return args
+	}
+	opts, _ := args[2].(*apiclient.GetMatchIdsOptions)
+	return append(args[:2:2], matchIdsArgs(opts)...)
+}
+
+// matchIdsArgs returns the key arguments for the options of GetMatchIds, with
+// times in epoch seconds as sent to the API.
+func matchIdsArgs(opts *apiclient.GetMatchIdsOptions) []interface{} {
+	var o apiclient.GetMatchIdsOptions
+	if opts != nil {
+		o = *opts
+	}
+	unix := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	return []interface{}{unix(o.StartTime), unix(o.EndTime), o.Queue, o.Type, o.Start, o.Count}
+}
+
+// lookupKey returns the cache key for the method and arguments. If fewer
+// arguments are given than the key has, then it returns the prefix shared by
+// all keys that start with those arguments, and prefix is true.
+func lookupKey(method string, args []interface{}) (key string, prefix bool, err error) {
+	m, ok := methods[method]
+	if !ok {
+		return "", false, fmt.Errorf("cachedclient: unknown method %q", method)
+	}
+	args = keyArgs(method, args)
+	parts := strings.Split(m.format, ":")
+	n := len(parts) - 1
+	if len(args) > n {
+		return "", false, fmt.Errorf("cachedclient: %s takes at most %d key arguments, got %d", method, n, len(args))
+	}
+	prefix = len(args) < n
+	format := strings.Join(parts[:len(args)+1], ":")
+	if prefix {
+		format += ":"
+	}
+	key = fmt.Sprintf(format, args...)
+	if strings.Contains(key, "%!") {
+		return "", false, fmt.Errorf("cachedclient: bad key arguments for %s: %s", method, key)
+	}
+	return key, prefix, nil
+}
@@ -0,0 +1,282 @@
+// Package memory implements in-process persistence for cached RPC calls.
+//
+// Use the NewDatastore() constructor to initialize a Datastore that can be
+// used to construct a cached client without any external dependencies, for
+// example in tests or small applications.
+package memory
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/cachedclient"
+)
+
+var zeroTime time.Time
+
+// entry is a single version of a value.
+type entry struct {
+	t   time.Time
+	val []byte
+}
+
+// item holds all versions of the value for a key. Timestamped versions are
+// sorted by time descending. The version written with the zero time, if any,
+// is kept separately, and is considered older than all timestamped versions.
+type item struct {
+	key       string
+	versions  []entry
+	unversion *entry
+	elem      *list.Element
+}
+
+// size returns the number of versions and the total encoded size.
+func (it *item) size() (entries, bytes int) {
+	for _, e := range it.versions {
+		bytes += len(e.val)
+	}
+	entries = len(it.versions)
+	if it.unversion != nil {
+		entries++
+		bytes += len(it.unversion.val)
+	}
+	return entries, bytes
+}
+
+// Option configures a memory datastore.
+type Option func(*memoryDatastore)
+
+// WithMaxEntries limits the total number of values, counting every version of
+// every key. Zero means no limit.
+func WithMaxEntries(n int) Option {
+	return func(m *memoryDatastore) {
+		m.maxEntries = n
+	}
+}
+
+// WithMaxBytes limits the total size of the JSON-encoded values. Zero means no
+// limit.
+func WithMaxBytes(n int) Option {
+	return func(m *memoryDatastore) {
+		m.maxBytes = n
+	}
+}
+
+type memoryDatastore struct {
+	maxEntries int
+	maxBytes   int
+
+	lock    sync.Mutex
+	items   map[string]*item
+	lru     *list.List
+	entries int
+	bytes   int
+}
+
+// touch marks the item as most recently used.
+func (m *memoryDatastore) touch(it *item) {
+	m.lru.MoveToFront(it.elem)
+}
+
+// remove deletes the item and all of its versions.
+func (m *memoryDatastore) remove(it *item) {
+	entries, bytes := it.size()
+	m.entries -= entries
+	m.bytes -= bytes
+	m.lru.Remove(it.elem)
+	delete(m.items, it.key)
+}
+
+// over returns true if the datastore exceeds its limits.
+func (m *memoryDatastore) over() bool {
+	return (m.maxEntries > 0 && m.entries > m.maxEntries) ||
+		(m.maxBytes > 0 && m.bytes > m.maxBytes)
+}
+
+// evict removes least recently used keys until the datastore is within its
+// limits. If only the given key remains, then its oldest versions are removed
+// instead.
+func (m *memoryDatastore) evict(keep *item) {
+	for m.over() {
+		back := m.lru.Back()
+		if back == nil {
+			return
+		}
+		it := back.Value.(*item)
+		if it != keep {
+			m.remove(it)
+			continue
+		}
+		// Drop the oldest version of the key that was just written.
+		switch {
+		case it.unversion != nil && len(it.versions) > 0:
+			m.entries--
+			m.bytes -= len(it.unversion.val)
+			it.unversion = nil
+		case len(it.versions) > 1:
+			last := it.versions[len(it.versions)-1]
+			it.versions = it.versions[:len(it.versions)-1]
+			m.entries--
+			m.bytes -= len(last.val)
+		default:
+			// A single value larger than the limits cannot be stored.
+			m.remove(it)
+			return
+		}
+	}
+}
+
+func (m *memoryDatastore) Get(ctx context.Context, key string, dest interface{}, t time.Time) (time.Time, error) {
+	m.lock.Lock()
+	it, ok := m.items[key]
+	var found *entry
+	if ok {
+		if !t.IsZero() {
+			// Versions are sorted descending, so find the first one that is
+			// not after t.
+			i := sort.Search(len(it.versions), func(i int) bool {
+				return !it.versions[i].t.After(t)
+			})
+			if i < len(it.versions) {
+				found = &it.versions[i]
+			}
+		}
+		if found == nil {
+			found = it.unversion
+		}
+		m.touch(it)
+	}
+	m.lock.Unlock()
+
+	if found == nil {
+		return zeroTime, fmt.Errorf("key %q is missing", key)
+	}
+	// Values are never modified once written, so they can be decoded without
+	// holding the lock.
+	if err := json.Unmarshal(found.val, dest); err != nil {
+		return zeroTime, err
+	}
+	return found.t, nil
+}
+
+func (m *memoryDatastore) Put(ctx context.Context, key string, val interface{}, t time.Time) error {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	it, ok := m.items[key]
+	if !ok {
+		it = &item{key: key}
+		it.elem = m.lru.PushFront(it)
+		m.items[key] = it
+	}
+	m.touch(it)
+
+	e := entry{t: t, val: b}
+	if t.IsZero() {
+		if it.unversion != nil {
+			m.entries--
+			m.bytes -= len(it.unversion.val)
+		}
+		it.unversion = &e
+	} else {
+		i := sort.Search(len(it.versions), func(i int) bool {
+			return !it.versions[i].t.After(t)
+		})
+		if i < len(it.versions) && it.versions[i].t.Equal(t) {
+			m.entries--
+			m.bytes -= len(it.versions[i].val)
+			it.versions[i] = e
+		} else {
+			it.versions = append(it.versions, entry{})
+			copy(it.versions[i+1:], it.versions[i:])
+			it.versions[i] = e
+		}
+	}
+	m.entries++
+	m.bytes += len(b)
+	m.evict(it)
+	return nil
+}
+
+func (m *memoryDatastore) Purge(ctx context.Context, key string, keep int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	it, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	if keep < len(it.versions) {
+		for _, e := range it.versions[keep:] {
+			m.entries--
+			m.bytes -= len(e.val)
+		}
+		it.versions = it.versions[:keep]
+	}
+	// The unversioned value is the oldest, so it is kept only if there is room
+	// after all timestamped versions.
+	if it.unversion != nil && keep <= len(it.versions) {
+		m.entries--
+		m.bytes -= len(it.unversion.val)
+		it.unversion = nil
+	}
+	if len(it.versions) == 0 && it.unversion == nil {
+		m.remove(it)
+	}
+	return nil
+}
+
+func (m *memoryDatastore) PurgePrefix(ctx context.Context, prefix string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, it := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(it)
+		}
+	}
+	return nil
+}
+
+func (m *memoryDatastore) Versions(ctx context.Context, key string, start, end time.Time) ([]time.Time, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	it, ok := m.items[key]
+	if !ok {
+		return nil, nil
+	}
+	m.touch(it)
+	var res []time.Time
+	// Versions are sorted descending, so iterate backwards to return them in
+	// ascending order.
+	for i := len(it.versions) - 1; i >= 0; i-- {
+		t := it.versions[i].t
+		if !t.Before(start) && !t.After(end) {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+// NewDatastore returns a Datastore that keeps values in memory, evicting the
+// least recently used keys once the configured limits are exceeded. Values are
+// stored JSON-encoded, so they are copied on Put and Get. The returned
+// Datastore is threadsafe.
+func NewDatastore(opts ...Option) cachedclient.HistoryDatastore {
+	m := &memoryDatastore{
+		items: make(map[string]*item),
+		lru:   list.New(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
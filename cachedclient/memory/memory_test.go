@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/cachedclient"
+)
+
+type value struct {
+	N int
+}
+
+// get returns the value for the key at the given time, and false if it is
+// missing.
+func get(t *testing.T, d cachedclient.Datastore, key string, at time.Time) (int, time.Time, bool) {
+	t.Helper()
+	var v value
+	ts, err := d.Get(context.Background(), key, &v, at)
+	if err != nil {
+		return 0, ts, false
+	}
+	return v.N, ts, true
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+	d := NewDatastore()
+	t1 := time.Unix(100, 0)
+	t2 := time.Unix(200, 0)
+
+	d.Put(ctx, "k", value{0}, zeroTime)
+	d.Put(ctx, "k", value{2}, t2)
+	d.Put(ctx, "k", value{1}, t1)
+
+	for _, tc := range []struct {
+		at   time.Time
+		want int
+		ts   time.Time
+	}{
+		{zeroTime, 0, zeroTime},
+		{time.Unix(50, 0), 0, zeroTime},
+		{t1, 1, t1},
+		{time.Unix(150, 0), 1, t1},
+		{time.Unix(300, 0), 2, t2},
+	} {
+		got, ts, ok := get(t, d, "k", tc.at)
+		if !ok || got != tc.want || !ts.Equal(tc.ts) {
+			t.Errorf("Get(%v) = %d, %v, %v; want %d, %v", tc.at, got, ts, ok, tc.want, tc.ts)
+		}
+	}
+
+	// Keeping one removes the older version and the unversioned value.
+	if err := d.Purge(ctx, "k", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "k", time.Unix(150, 0)); ok {
+		t.Error("got purged version")
+	}
+	if got, _, ok := get(t, d, "k", time.Unix(300, 0)); !ok || got != 2 {
+		t.Errorf("got %d, %v after purge, want 2", got, ok)
+	}
+
+	if err := d.Purge(ctx, "k", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "k", time.Unix(300, 0)); ok {
+		t.Error("got value after purging all versions")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	d := NewDatastore(WithMaxEntries(2))
+
+	d.Put(ctx, "a", value{1}, zeroTime)
+	d.Put(ctx, "b", value{2}, zeroTime)
+	// Reading a makes b the least recently used key.
+	get(t, d, "a", zeroTime)
+	d.Put(ctx, "c", value{3}, zeroTime)
+
+	if _, _, ok := get(t, d, "b", zeroTime); ok {
+		t.Error("least recently used key was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, _, ok := get(t, d, key, zeroTime); !ok {
+			t.Errorf("key %s was evicted", key)
+		}
+	}
+
+	// A key with more versions than the limit keeps the most recent ones.
+	for i := 1; i <= 3; i++ {
+		d.Put(ctx, "h", value{i}, time.Unix(int64(i), 0))
+	}
+	if got, _, ok := get(t, d, "h", time.Unix(10, 0)); !ok || got != 3 {
+		t.Errorf("got %d, %v, want 3", got, ok)
+	}
+	if _, _, ok := get(t, d, "h", time.Unix(1, 0)); ok {
+		t.Error("oldest version was not evicted")
+	}
+
+	b := NewDatastore(WithMaxBytes(len(`{"N":1}`)))
+	b.Put(ctx, "a", value{1}, zeroTime)
+	b.Put(ctx, "b", value{2}, zeroTime)
+	if _, _, ok := get(t, b, "a", zeroTime); ok {
+		t.Error("key exceeding the byte limit was not evicted")
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	ctx := context.Background()
+	d := NewDatastore(WithMaxEntries(50))
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("k%d", i%20)
+				d.Put(ctx, key, value{i}, time.Unix(int64(i), 0))
+				get(t, d, key, time.Unix(int64(i), 0))
+				if i%10 == 0 {
+					d.Purge(ctx, key, 1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	m := d.(*memoryDatastore)
+	entries, bytes := 0, 0
+	for _, it := range m.items {
+		e, b := it.size()
+		entries += e
+		bytes += b
+	}
+	if entries != m.entries || bytes != m.bytes {
+		t.Errorf("got accounting %d entries, %d bytes; want %d, %d", m.entries, m.bytes, entries, bytes)
+	}
+	if m.entries > 50 {
+		t.Errorf("got %d entries, want at most 50", m.entries)
+	}
+}
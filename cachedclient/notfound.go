@@ -0,0 +1,53 @@
+package cachedclient
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultNotFoundTTL is how long not-found results are cached unless
+// configured otherwise.
+const DefaultNotFoundTTL = 5 * time.Minute
+
+// notFoundEntry is stored in place of a value that does not exist.
+type notFoundEntry struct {
+	NotFound bool
+}
+
+// WithNotFoundTTL sets how long not-found results are cached for methods
+// whose policy does not set NotFoundTTL. Zero disables negative caching.
+func WithNotFoundTTL(d time.Duration) Option {
+	return func(c *client) {
+		c.notFoundTTL = d
+	}
+}
+
+// notFoundKey returns the key under which a not-found result for the key is
+// stored, which is separate since the stored type differs.
+func notFoundKey(key string) string {
+	return "not-found:" + key
+}
+
+// checkNotFound returns whether a fresh not-found result is cached for the
+// key, and whether any not-found result exists.
+func (c *client) checkNotFound(ctx context.Context, p Policy, key string) (fresh, exists bool, t time.Time) {
+	var e notFoundEntry
+	t, err := c.d.Get(ctx, notFoundKey(key), &e, time.Now())
+	if err != nil || !e.NotFound {
+		return false, false, t
+	}
+	return time.Since(t) < p.NotFoundTTL, true, t
+}
+
+// storeNotFound records that the value for the key does not exist.
+func (c *client) storeNotFound(ctx context.Context, key string) {
+	nk := notFoundKey(key)
+	if err := c.d.Put(ctx, nk, &notFoundEntry{NotFound: true}, time.Now()); err == nil {
+		c.janitor.purge(nk, 1)
+	}
+}
+
+// clearNotFound removes a not-found result after the value was found.
+func (c *client) clearNotFound(key string) {
+	c.janitor.purge(notFoundKey(key), 0)
+}
@@ -0,0 +1,248 @@
+package cachedclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+)
+
+// Policy determines how the results of a Client method are cached.
+type Policy struct {
+	// TTL is how long a cached result is considered fresh. The zero value
+	// means that results never expire, which is appropriate for immutable data
+	// such as finished matches.
+	TTL time.Duration
+
+	// KeepHistory retains every result written for a key, so that earlier
+	// observations remain available in the Datastore. Otherwise, only the most
+	// recent result is kept. It has no effect on results that never expire.
+	KeepHistory bool
+
+	// NeverCache disables caching for the method, so every call is passed
+	// through to the underlying Client.
+	NeverCache bool
+
+	// StaleWhileRevalidate is how long after the TTL a cached result is still
+	// returned immediately, while a fresh result is fetched in the background.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is how long after the TTL a cached result is returned if
+	// fetching a fresh result fails.
+	StaleIfError time.Duration
+
+	// NotFoundTTL is how long a not-found result is cached, so that repeated
+	// lookups of missing data return apiclient.ErrDataNotFound without calling
+	// Riot. Zero uses the client default, and a negative value disables
+	// caching of not-found results.
+	NotFoundTTL time.Duration
+}
+
+var (
+	// Immutable caches results forever.
+	Immutable = Policy{}
+
+	// NeverCache passes every call through to the underlying Client.
+	NeverCache = Policy{NeverCache: true}
+)
+
+// TTL returns a policy that caches results for the given duration, keeping
+// only the most recent result.
+func TTL(d time.Duration) Policy {
+	return Policy{TTL: d}
+}
+
+// History returns a policy that caches results for the given duration, and
+// keeps all earlier results in the Datastore.
+func History(d time.Duration) Policy {
+	return Policy{TTL: d, KeepHistory: true}
+}
+
+// defaultPolicies maps each Client method name to its default policy.
+var defaultPolicies = map[string]Policy{
+	// Champion Mastery API
+	"GetAllChampionMasteries":        TTL(24 * time.Hour),
+	"GetAllChampionMasteriesByPuuid": TTL(24 * time.Hour),
+	"GetChampionMastery":             TTL(24 * time.Hour),
+	"GetChampionMasteryScore":        TTL(24 * time.Hour),
+
+	// Champions API
+	"GetChampions":    TTL(24 * time.Hour),
+	"GetChampionByID": TTL(24 * time.Hour),
+
+	// League API
+	"GetChallengerLeague":              History(24 * time.Hour),
+	"GetGrandmasterLeague":             History(24 * time.Hour),
+	"GetMasterLeague":                  History(24 * time.Hour),
+	"GetAllLeaguePositionsForSummoner": History(24 * time.Hour),
+	"GetLeagueByID":                    History(24 * time.Hour),
+
+	// Match API. Match-v5 only serves finished matches, so matches and
+	// timelines never change.
+	"GetMatch":           Immutable,
+	"GetMatchTimeline":   Immutable,
+	"GetMatchlist":       TTL(24 * time.Hour),
+	"GetMatchIds":        TTL(time.Hour),
+	"GetRecentMatchlist": TTL(time.Hour),
+
+	// Spectator API
+	"GetFeaturedGames":             TTL(time.Hour),
+	"GetCurrentGameInfoBySummoner": NeverCache,
+
+	// Summoner and Account APIs. Encrypted IDs and PUUIDs never change for a
+	// given key, but names and levels do.
+	"GetByAccountID":             Immutable,
+	"GetBySummonerName":          TTL(24 * time.Hour),
+	"GetBySummonerPUUID":         TTL(24 * time.Hour),
+	"GetBySummonerID":            Immutable,
+	"GetRiotAccountByNameAndTag": TTL(24 * time.Hour),
+	"GetRiotAccountByPuuid":      TTL(24 * time.Hour),
+
+	// Third Party Code API. Codes are used for verification, so they must be
+	// current.
+	"GetThirdPartyCodeByID": NeverCache,
+}
+
+// Option configures a cached client.
+type Option func(*client)
+
+// WithStaleWhileRevalidate sets the minimum StaleWhileRevalidate window for
+// all methods.
+func WithStaleWhileRevalidate(d time.Duration) Option {
+	return func(c *client) {
+		c.staleWhileRevalidate = d
+	}
+}
+
+// WithStaleIfError sets the minimum StaleIfError window for all methods.
+func WithStaleIfError(d time.Duration) Option {
+	return func(c *client) {
+		c.staleIfError = d
+	}
+}
+
+// WithPolicy overrides the policy for the Client method with the given name,
+// such as "GetMatch". It panics if the name is not a Client method.
+func WithPolicy(method string, p Policy) Option {
+	if _, ok := defaultPolicies[method]; !ok {
+		panic(fmt.Sprintf("cachedclient: unknown method %q", method))
+	}
+	return func(c *client) {
+		c.policies[method] = p
+	}
+}
+
+// fetchFunc calls the underlying client, and returns the result to be cached
+// as a pointer.
+type fetchFunc func(ctx context.Context) (interface{}, error)
+
+// policy returns the policy for the method, including client-wide options.
+func (c *client) policy(method string) Policy {
+	p := c.policies[method]
+	if c.staleWhileRevalidate > p.StaleWhileRevalidate {
+		p.StaleWhileRevalidate = c.staleWhileRevalidate
+	}
+	if c.staleIfError > p.StaleIfError {
+		p.StaleIfError = c.staleIfError
+	}
+	if p.NotFoundTTL == 0 {
+		p.NotFoundTTL = c.notFoundTTL
+	}
+	return p
+}
+
+// setValue copies the fetched result into val.
+func setValue(val, res interface{}) {
+	reflect.ValueOf(val).Elem().Set(reflect.ValueOf(res).Elem())
+}
+
+// cached fills val with the cached result for the key if it is fresh
+// according to the policy of the method. Otherwise, it calls fetch and stores
+// the result. Concurrent calls for the same key are coalesced, so that the
+// Datastore and the underlying client are only called once. Errors writing to
+// the Datastore are not returned, since the fetched result is still valid.
+func (c *client) cached(ctx context.Context, method, key string, val interface{}, fetch fetchFunc) error {
+	res, err := c.flight.do(ctx, key, val, func() (Result, error) {
+		return c.fill(ctx, method, key, val, fetch)
+	})
+	c.count(method, res)
+	if r, ok := ctx.Value(resultKey{}).(*Result); ok {
+		*r = res
+	}
+	return err
+}
+
+// fill implements cached without coalescing.
+func (c *client) fill(ctx context.Context, method, key string, val interface{}, fetch fetchFunc) (Result, error) {
+	p := c.policy(method)
+	if p.NeverCache {
+		res, err := fetch(ctx)
+		if err != nil {
+			return Result{}, err
+		}
+		setValue(val, res)
+		return Result{}, nil
+	}
+
+	t := zeroTime
+	if p.TTL > 0 {
+		t = time.Now()
+	}
+	got, err := c.d.Get(ctx, key, val, t)
+	hit := err == nil
+	age := time.Since(got)
+	if hit {
+		if p.TTL == 0 || age < p.TTL {
+			return Result{Cached: true, Time: got}, nil
+		}
+	}
+
+	// Not-found results are only checked on a miss, so that fresh hits do not
+	// require another lookup.
+	var notFound bool
+	if p.NotFoundTTL > 0 {
+		fresh, exists, t := c.checkNotFound(ctx, p, key)
+		if fresh {
+			return Result{Cached: true, Time: t}, apiclient.ErrDataNotFound
+		}
+		notFound = exists
+	}
+
+	if hit {
+		if age < p.TTL+p.StaleWhileRevalidate {
+			c.revalidate(method, key, fetch)
+			return Result{Cached: true, Stale: true, Time: got}, nil
+		}
+	}
+
+	res, err := fetch(ctx)
+	if err != nil {
+		if hit && age < p.TTL+p.StaleIfError && canServeStale(err) {
+			return Result{Cached: true, Stale: true, Time: got, Err: err}, nil
+		}
+		if err == apiclient.ErrDataNotFound && p.NotFoundTTL > 0 {
+			c.storeNotFound(ctx, key)
+		}
+		return Result{}, err
+	}
+	setValue(val, res)
+	c.store(ctx, p, key, res)
+	if notFound {
+		c.clearNotFound(key)
+	}
+	return Result{}, nil
+}
+
+// store writes the fetched result to the Datastore according to the policy.
+func (c *client) store(ctx context.Context, p Policy, key string, res interface{}) {
+	t := zeroTime
+	if p.TTL > 0 {
+		t = time.Now()
+	}
+	err := c.d.Put(ctx, key, res, t)
+	if err == nil && p.TTL > 0 && !p.KeepHistory {
+		c.janitor.purge(key, 1)
+	}
+}
@@ -0,0 +1,79 @@
+package cachedclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tilo-K/riot/apiclient"
+)
+
+// revalidateTimeout bounds background refreshes of stale results.
+const revalidateTimeout = time.Minute
+
+// Result describes how a call to a cached client was served.
+type Result struct {
+	// Cached is true if the value was read from the Datastore rather than
+	// fetched from the underlying client.
+	Cached bool
+
+	// Stale is true if the cached value is older than the TTL of the method.
+	Stale bool
+
+	// Coalesced is true if the call waited for a concurrent call with the
+	// same arguments and shared its result, which the other fields describe.
+	Coalesced bool
+
+	// Time is when the cached value was written. It is zero for fetched values
+	// and values that never expire.
+	Time time.Time
+
+	// Err is the error from the underlying client if a stale value was
+	// returned in its place.
+	Err error
+}
+
+type resultKey struct{}
+
+// WithResult returns a context that records how calls made with it are
+// served. After each call, res describes the most recent call, so the context
+// should not be shared by concurrent calls.
+func WithResult(ctx context.Context, res *Result) context.Context {
+	return context.WithValue(ctx, resultKey{}, res)
+}
+
+// canServeStale returns true if a stale value may be returned in place of the
+// error. Cancellation is returned to the caller, and missing data is an
+// authoritative answer rather than a failure.
+func canServeStale(err error) bool {
+	return !isContextError(err) && err != apiclient.ErrDataNotFound
+}
+
+// revalidate fetches and stores a fresh result for the key in the background,
+// unless a refresh for the key is already in progress.
+func (c *client) revalidate(method, key string, fetch fetchFunc) {
+	c.refreshLock.Lock()
+	if c.refreshing[key] {
+		c.refreshLock.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.refreshLock.Unlock()
+
+	go func() {
+		defer func() {
+			c.refreshLock.Lock()
+			delete(c.refreshing, key)
+			c.refreshLock.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+		p := c.policy(method)
+		res, err := fetch(ctx)
+		switch {
+		case err == nil:
+			c.store(ctx, p, key, res)
+		case err == apiclient.ErrDataNotFound && p.NotFoundTTL > 0:
+			c.storeNotFound(ctx, key)
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package cachedclient
+
+// Stats counts how calls to a cached method were served.
+type Stats struct {
+	// Hits is the number of calls served by a fresh cached result, including
+	// cached not-found results.
+	Hits uint64
+
+	// Stale is the number of calls served by a stale cached result, either
+	// while revalidating or because fetching a fresh result failed.
+	Stale uint64
+
+	// Misses is the number of calls passed through to the underlying client,
+	// including calls to methods that are never cached.
+	Misses uint64
+
+	// Coalesced is the number of calls that shared the result of a concurrent
+	// call with the same arguments, which is counted once by its own outcome.
+	Coalesced uint64
+}
+
+// HitRatio returns the fraction of calls served without calling the
+// underlying client, or zero if there have been no calls.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Stale + s.Misses + s.Coalesced
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.Stale+s.Coalesced) / float64(total)
+}
+
+// count updates the stats for the method with the result of a call.
+func (c *client) count(method string, res Result) {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	s, ok := c.stats[method]
+	if !ok {
+		s = &Stats{}
+		c.stats[method] = s
+	}
+	switch {
+	case res.Coalesced:
+		s.Coalesced++
+	case res.Stale:
+		s.Stale++
+	case res.Cached:
+		s.Hits++
+	default:
+		s.Misses++
+	}
+}
+
+func (c *client) Stats() map[string]Stats {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+	res := make(map[string]Stats, len(c.stats))
+	for method, s := range c.stats {
+		res[method] = *s
+	}
+	return res
+}
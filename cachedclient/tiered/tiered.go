@@ -0,0 +1,135 @@
+// Package tiered implements layered persistence for cached RPC calls.
+//
+// Use the NewDatastore() constructor to put a fast Datastore, such as a
+// bounded memory Datastore, in front of a slower persistent one, such as the
+// Google Cloud Datastore. The persistent Datastore must be written only
+// through the tiered one, so it cannot be shared between processes.
+package tiered
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tilo-K/riot/cachedclient"
+)
+
+// currentWindow is how close to the current time a lookup must be for its
+// result to be copied to the front tier. Lookups by the cached client are for
+// the current time, while earlier lookups read history and may not return the
+// most recent version.
+const currentWindow = time.Second
+
+type tieredDatastore struct {
+	front cachedclient.Datastore
+	back  cachedclient.Datastore
+}
+
+// unversionedKey returns the key under which the front tier stores the value
+// written with the zero time, so that purging the timestamped versions of the
+// key in the front does not remove it.
+func unversionedKey(key string) string {
+	return "\x00" + key
+}
+
+// The front tier holds at most the most recent version of each key known to
+// this process, and separately the value written with the zero time. Since
+// this Datastore is the only writer to the back tier, no newer version exists
+// there, so a timestamped version from the front is returned for any time that
+// is not before it. Every other lookup is passed to the back tier.
+func (d *tieredDatastore) Get(ctx context.Context, key string, dest interface{}, t time.Time) (time.Time, error) {
+	if t.IsZero() {
+		if _, err := d.front.Get(ctx, unversionedKey(key), dest, t); err == nil {
+			return t, nil
+		}
+	} else if got, err := d.front.Get(ctx, key, dest, t); err == nil && !got.IsZero() {
+		return got, nil
+	}
+	got, err := d.back.Get(ctx, key, dest, t)
+	if err != nil {
+		return got, err
+	}
+	switch {
+	case got.IsZero():
+		d.front.Put(ctx, unversionedKey(key), dest, got)
+	case time.Since(t) < currentWindow:
+		d.putFront(ctx, key, dest, got)
+	}
+	return got, nil
+}
+
+// putFront writes a timestamped version to the front tier, keeping only the
+// most recent version.
+func (d *tieredDatastore) putFront(ctx context.Context, key string, val interface{}, t time.Time) {
+	if err := d.front.Put(ctx, key, val, t); err == nil {
+		d.front.Purge(ctx, key, 1)
+	}
+}
+
+func (d *tieredDatastore) Put(ctx context.Context, key string, val interface{}, t time.Time) error {
+	if err := d.back.Put(ctx, key, val, t); err != nil {
+		return err
+	}
+	if t.IsZero() {
+		d.front.Put(ctx, unversionedKey(key), val, t)
+	} else {
+		d.putFront(ctx, key, val, t)
+	}
+	return nil
+}
+
+// Purge removes values from the back tier first, so that a concurrent Get
+// cannot copy a removed value to the front. The front keeps at most the most
+// recent version, which the back also keeps unless keep is zero. Whether the
+// back keeps the value written with the zero time depends on how many
+// versions it has, so the front drops it, and copies it again if needed.
+func (d *tieredDatastore) Purge(ctx context.Context, key string, keep int) error {
+	if err := d.back.Purge(ctx, key, keep); err != nil {
+		return err
+	}
+	if keep > 1 {
+		keep = 1
+	}
+	if err := d.front.Purge(ctx, unversionedKey(key), 0); err != nil {
+		return err
+	}
+	return d.front.Purge(ctx, key, keep)
+}
+
+func (d *tieredDatastore) PurgePrefix(ctx context.Context, prefix string) error {
+	if err := d.back.PurgePrefix(ctx, prefix); err != nil {
+		return err
+	}
+	if err := d.front.PurgePrefix(ctx, unversionedKey(prefix)); err != nil {
+		return err
+	}
+	return d.front.PurgePrefix(ctx, prefix)
+}
+
+// historyDatastore is a tieredDatastore whose back tier can list versions.
+type historyDatastore struct {
+	*tieredDatastore
+}
+
+// Versions lists the versions in the back tier, which holds all of them.
+func (d historyDatastore) Versions(ctx context.Context, key string, start, end time.Time) ([]time.Time, error) {
+	return d.back.(cachedclient.HistoryDatastore).Versions(ctx, key, start, end)
+}
+
+// NewDatastore returns a Datastore that reads from the front tier when it can,
+// and from the back tier otherwise, copying current values to the front. Puts
+// are written to the back tier and then to the front. The front tier should be
+// bounded, for example with memory.WithMaxEntries(). If the back tier is a
+// HistoryDatastore, then so is the returned Datastore.
+//
+// The back tier must not be written by other processes, or by other
+// Datastores in this process. The front tier is not checked against the back
+// tier, so a newer version written there by another writer is not seen until
+// the version in the front tier is purged or evicted. To share a back tier,
+// give each process a cached client on the back tier alone.
+func NewDatastore(front, back cachedclient.Datastore) cachedclient.Datastore {
+	d := &tieredDatastore{front: front, back: back}
+	if _, ok := back.(cachedclient.HistoryDatastore); ok {
+		return historyDatastore{d}
+	}
+	return d
+}
@@ -0,0 +1,109 @@
+package tiered
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/cachedclient"
+	"github.com/Tilo-K/riot/cachedclient/memory"
+)
+
+type value struct {
+	N int
+}
+
+// countingDatastore counts calls to Get.
+type countingDatastore struct {
+	cachedclient.HistoryDatastore
+	gets int
+}
+
+func (c *countingDatastore) Get(ctx context.Context, key string, dest interface{}, t time.Time) (time.Time, error) {
+	c.gets++
+	return c.HistoryDatastore.Get(ctx, key, dest, t)
+}
+
+// get returns the value for the key at the given time, and false if it is
+// missing.
+func get(t *testing.T, d cachedclient.Datastore, key string, at time.Time) (int, time.Time, bool) {
+	t.Helper()
+	var v value
+	ts, err := d.Get(context.Background(), key, &v, at)
+	if err != nil {
+		return 0, ts, false
+	}
+	return v.N, ts, true
+}
+
+func TestTiers(t *testing.T) {
+	ctx := context.Background()
+	back := &countingDatastore{HistoryDatastore: memory.NewDatastore()}
+	front := memory.NewDatastore()
+	d := NewDatastore(front, back)
+	if _, ok := d.(cachedclient.HistoryDatastore); !ok {
+		t.Error("got a Datastore that cannot list versions of a HistoryDatastore")
+	}
+
+	now := time.Now()
+	t1 := now.Add(-2 * time.Hour)
+	t2 := now.Add(-time.Hour)
+	d.Put(ctx, "k", value{0}, time.Time{})
+	d.Put(ctx, "k", value{2}, t2)
+	d.Put(ctx, "k", value{1}, t1)
+
+	// Current and unversioned lookups are served by the front.
+	if got, ts, ok := get(t, d, "k", time.Now()); !ok || got != 2 || !ts.Equal(t2) {
+		t.Errorf("got %d at %v, %v; want 2 at %v", got, ts, ok, t2)
+	}
+	if got, _, ok := get(t, d, "k", time.Time{}); !ok || got != 0 {
+		t.Errorf("got %d, %v for the zero time, want 0", got, ok)
+	}
+	if back.gets != 0 {
+		t.Errorf("got %d reads of the back tier, want 0", back.gets)
+	}
+
+	// Earlier versions are only in the back, and are not copied forward.
+	for i := 0; i < 2; i++ {
+		if got, ts, ok := get(t, d, "k", t1.Add(time.Minute)); !ok || got != 1 || !ts.Equal(t1) {
+			t.Errorf("got %d at %v, %v; want 1 at %v", got, ts, ok, t1)
+		}
+	}
+	if got, _, ok := get(t, d, "k", time.Now()); !ok || got != 2 {
+		t.Errorf("got %d, %v after reading history, want 2", got, ok)
+	}
+	if back.gets != 2 {
+		t.Errorf("got %d reads of the back tier, want 2", back.gets)
+	}
+
+	// Values missing from the front are copied from the back.
+	back.Put(ctx, "other", value{3}, now)
+	for i := 0; i < 2; i++ {
+		if got, _, ok := get(t, d, "other", time.Now()); !ok || got != 3 {
+			t.Errorf("got %d, %v, want 3", got, ok)
+		}
+	}
+	if back.gets != 3 {
+		t.Errorf("got %d reads of the back tier, want 3", back.gets)
+	}
+
+	// Purging keeps the tiers consistent.
+	if err := d.Purge(ctx, "k", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "k", time.Time{}); ok {
+		t.Error("got purged unversioned value")
+	}
+	if err := d.Purge(ctx, "k", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "k", time.Now()); ok {
+		t.Error("got value after purging all versions")
+	}
+	if err := d.PurgePrefix(ctx, "oth"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := get(t, d, "other", time.Now()); ok {
+		t.Error("got value after purging by prefix")
+	}
+}
@@ -1,7 +1,11 @@
 // Package region defines region constants.
 package v5region
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/Tilo-K/riot/constants/region"
+)
 
 // Region represents a Riot server region. Only constants defined in this
 // package are valid inputs for the client.
@@ -40,3 +44,22 @@ func (r V5Region) Host() string {
 		panic(fmt.Sprintf("region %s does not have a configured host", r))
 	}
 }
+
+// ForRegion returns the regional routing value that serves the match-v5 data
+// of the platform region. It is not valid for account-v1, which has no Sea
+// route; accounts of any region can be looked up through Americas, Asia or
+// Europe. This function panics if an invalid region is used.
+func ForRegion(r region.Region) V5Region {
+	switch r {
+	case region.BR1, region.LA1, region.LA2, region.NA1:
+		return Americas
+	case region.JP1, region.KR:
+		return Asia
+	case region.EUN1, region.EUW1, region.RU, region.TR1:
+		return Europe
+	case region.OC1:
+		return Sea
+	default:
+		panic(fmt.Sprintf("region %s does not have a regional route", r))
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/Tilo-K/riot/constants/champion"
 	"github.com/Tilo-K/riot/constants/queue"
 	"github.com/Tilo-K/riot/constants/region"
+	"github.com/Tilo-K/riot/constants/v5region"
 	"github.com/Tilo-K/riot/ratelimit"
 )
 
@@ -24,9 +25,10 @@ const (
 	playerID = "x9k0laU59wtIYnd8zt1dZmtJ_wXl13bqjhTRRC8FPwTbYVA" // These are encrypted per the api key used
 	name     = "waddlechirp"
 	account  = "hJN7Yl1FSZLD4vGKUIAMVFI_IWqK7WmY6Lb9S2QGRSUes8U" // These are encrypted per the api key used
-	game     = 2644987649
+	game     = "NA1_2644987649"
 	league   = "6b5c7950-5260-11e7-8125-c81f66dbb56c"
 	reg      = region.NA1
+	v5reg    = v5region.Americas
 )
 
 func prettyPrint(res interface{}, err error) {
@@ -100,11 +102,11 @@ func main() {
 	// Match
 
 	fmt.Println("GetMatch")
-	myMatch, err := client.GetMatch(ctx, reg, game)
+	myMatch, err := client.GetMatch(ctx, v5reg, game)
 	prettyPrint(myMatch, err)
 
 	fmt.Println("GetMatchTimeline")
-	timeline, err := client.GetMatchTimeline(ctx, reg, game)
+	timeline, err := client.GetMatchTimeline(ctx, v5reg, game)
 	prettyPrint(timeline, err)
 
 	fmt.Println("GetMatchlist")
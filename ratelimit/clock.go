@@ -0,0 +1,56 @@
+package ratelimit
+
+import "time"
+
+// Clock is a source of time for a limiter. Use SystemClock outside of tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a timer that sends the current time on its channel
+	// after the duration.
+	NewTimer(d time.Duration) Timer
+
+	// AfterFunc calls f in its own goroutine after the duration.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event scheduled by a Clock.
+type Timer interface {
+	// C returns the channel on which the time is sent. It is nil for timers
+	// returned by AfterFunc.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, and returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
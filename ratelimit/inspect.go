@@ -0,0 +1,207 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// LimitState is a snapshot of a single time interval limit.
+type LimitState struct {
+	// Seconds is the length of the interval in seconds.
+	Seconds int64
+
+	// Capacity is the configured number of calls allowed per interval.
+	Capacity int64
+
+	// Available is the number of calls that can currently be acquired.
+	Available int64
+}
+
+// Used returns the number of calls that are counted against the interval.
+func (l LimitState) Used() int64 {
+	return l.Capacity - l.Available
+}
+
+// InvocationState is a snapshot of the limits tracked for an invocation. The
+// Invocation with empty Method field corresponds to application-level limits.
+type InvocationState struct {
+	Invocation Invocation
+	Limits     []LimitState
+
+	// Wake is the time until which acquisitions are blocked following a rate
+	// limit violation. The zero value means that no penalty is active.
+	Wake time.Time
+
+	// ServiceWake is the time until which acquisitions are blocked following
+	// a service rate limit violation, which is enforced by Riot independently
+	// of the key's limits. The zero value means that no backoff is active.
+	ServiceWake time.Time
+
+	// ServiceFailures is the number of consecutive service rate limit
+	// violations, which determines the backoff.
+	ServiceFailures int
+}
+
+// Inspector is implemented by limiters that can report their internal state.
+// The state is intended for debugging and monitoring, and may be stale by the
+// time it is returned.
+type Inspector interface {
+	Inspect() []InvocationState
+}
+
+// InvocationInspector is implemented by limiters that can report the state of
+// a single invocation without walking all tracked invocations.
+type InvocationInspector interface {
+	// InspectInvocation returns the state of the invocation, and false if the
+	// invocation has no configured limits, active wake penalty or recent
+	// service rate limit violations.
+	InspectInvocation(inv Invocation) (InvocationState, bool)
+}
+
+// QuotaReporter is implemented by limiters that can cheaply report the
+// remaining quota of a single invocation, for example to choose between
+// several application keys.
+type QuotaReporter interface {
+	// Available returns the number of calls that can currently be acquired
+	// under the invocation's own limits, 0 while a wake penalty is active, or
+	// -1 if no limits are known for the invocation.
+	Available(inv Invocation) int64
+
+	// Capacity returns the smallest number of calls allowed per interval
+	// under the invocation's own limits, or -1 if no limits are known for the
+	// invocation.
+	Capacity(inv Invocation) int64
+}
+
+// KeyID returns a stable identifier for the application key that does not
+// reveal the key itself. It is safe to write the identifier to logs.
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// State returns a snapshot of the limit.
+func (s *singleLimit) State(seconds int64) LimitState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return LimitState{
+		Seconds:   seconds,
+		Capacity:  s.capacity,
+		Available: s.quantity,
+	}
+}
+
+// Inspect returns the state of all invocations that have configured limits,
+// an active wake penalty or recent service rate limit violations.
+func (l *limiter) Inspect() []InvocationState {
+	now := l.clock.Now()
+	states := make(map[Invocation]*InvocationState)
+
+	l.limits.Range(func(key, value interface{}) bool {
+		inv := key.(Invocation)
+		st := &InvocationState{Invocation: inv}
+		value.(*invocationLimit).ForEachLimit(func(seconds int64, lim *singleLimit) bool {
+			st.Limits = append(st.Limits, lim.State(seconds))
+			return true
+		})
+		states[inv] = st
+		return true
+	})
+
+	l.lock.RLock()
+	for inv, wake := range l.methodWake {
+		if !wake.After(now) {
+			continue
+		}
+		st, ok := states[inv]
+		if !ok {
+			st = &InvocationState{Invocation: inv}
+			states[inv] = st
+		}
+		st.Wake = wake
+	}
+	for inv, failures := range l.serviceFailures {
+		st, ok := states[inv]
+		if !ok {
+			st = &InvocationState{Invocation: inv}
+			states[inv] = st
+		}
+		st.ServiceFailures = failures
+		if wake := l.serviceWake[inv]; wake.After(now) {
+			st.ServiceWake = wake
+		}
+	}
+	l.lock.RUnlock()
+
+	res := make([]InvocationState, 0, len(states))
+	for _, st := range states {
+		res = append(res, *st)
+	}
+	return res
+}
+
+// InspectInvocation returns the state of the invocation in the same form as
+// Inspect.
+func (l *limiter) InspectInvocation(inv Invocation) (InvocationState, bool) {
+	st := InvocationState{Invocation: inv}
+	ok := false
+	if il := l.getInvocationLimit(inv); il != nil {
+		ok = true
+		il.ForEachLimit(func(seconds int64, lim *singleLimit) bool {
+			st.Limits = append(st.Limits, lim.State(seconds))
+			return true
+		})
+	}
+
+	now := l.clock.Now()
+	l.lock.RLock()
+	if wake := l.methodWake[inv]; wake.After(now) {
+		ok = true
+		st.Wake = wake
+	}
+	if failures, found := l.serviceFailures[inv]; found {
+		ok = true
+		st.ServiceFailures = failures
+		if wake := l.serviceWake[inv]; wake.After(now) {
+			st.ServiceWake = wake
+		}
+	}
+	l.lock.RUnlock()
+	return st, ok
+}
+
+// Available returns the smallest number of calls that can currently be
+// acquired under any of the invocation's limits.
+func (l *limiter) Available(inv Invocation) int64 {
+	l.lock.RLock()
+	wake := l.methodWake[inv]
+	l.lock.RUnlock()
+	if wake.After(l.clock.Now()) {
+		return 0
+	}
+
+	return l.smallest(inv, func(st LimitState) int64 { return st.Available })
+}
+
+// Capacity returns the smallest capacity of any of the invocation's limits.
+func (l *limiter) Capacity(inv Invocation) int64 {
+	return l.smallest(inv, func(st LimitState) int64 { return st.Capacity })
+}
+
+// smallest returns the smallest value of f over the invocation's limits, or -1
+// if no limits are known.
+func (l *limiter) smallest(inv Invocation, f func(st LimitState) int64) int64 {
+	il := l.getInvocationLimit(inv)
+	if il == nil {
+		return -1
+	}
+	res := int64(-1)
+	il.ForEachLimit(func(seconds int64, lim *singleLimit) bool {
+		if v := f(lim.State(seconds)); res < 0 || v < res {
+			res = v
+		}
+		return true
+	})
+	return res
+}
@@ -7,7 +7,8 @@ import (
 
 // singleLimit is a rate limit corresponding to a specific time interval.
 type singleLimit struct {
-	lock sync.Mutex
+	lock  sync.Mutex
+	clock Clock
 
 	// riotMatcher is a timer that fires a reconciliation event. For example, if
 	// Riot believes we have used 100 and we believe we have used 90, then we
@@ -15,7 +16,7 @@ type singleLimit struct {
 	// after some time has elapsed. Only one reconciliation event is needed at
 	// any given point, since a future reconciliation should immediately replace
 	// the existing one.
-	riotMatcher *time.Timer
+	riotMatcher Timer
 
 	// riotOffset is the quantity that will be added back following the
 	// expiration of riotMatcher.
@@ -49,7 +50,7 @@ func (s *singleLimit) Cancel() {
 
 // AddQuantity adds or subtracts the resource after the given duration.
 func (s *singleLimit) AddQuantity(q int64, d time.Duration) {
-	time.AfterFunc(d, func() {
+	s.clock.AfterFunc(d, func() {
 		s.lock.Lock()
 		defer s.lock.Unlock()
 		s.quantity += q
@@ -96,7 +97,7 @@ func (s *singleLimit) MatchRiotCounts(counts int64, reverseAfter time.Duration)
 	if impliedQuantity != s.quantity {
 		s.riotOffset = s.quantity - impliedQuantity
 		s.quantity -= s.riotOffset
-		s.riotMatcher = time.AfterFunc(reverseAfter, func() {
+		s.riotMatcher = s.clock.AfterFunc(reverseAfter, func() {
 			s.lock.Lock()
 			defer s.lock.Unlock()
 			s.quantity += s.riotOffset
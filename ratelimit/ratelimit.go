@@ -80,6 +80,8 @@ type Limiter interface {
 type invocationLimit struct {
 	// limits maps interval length in seconds to the *singleLimit.
 	limits sync.Map
+
+	clock Clock
 }
 
 // Get returns the singleLimit for the interval in seconds, or nil if no limit is
@@ -104,6 +106,7 @@ func (i *invocationLimit) ForEachLimit(f func(seconds int64, limit *singleLimit)
 // given capacity.
 func (i *invocationLimit) SetLimitCapacity(seconds, capacity int64) {
 	o, _ := i.limits.LoadOrStore(seconds, &singleLimit{
+		clock:    i.clock,
 		capacity: capacity,
 		quantity: capacity,
 	})
@@ -112,8 +115,17 @@ func (i *invocationLimit) SetLimitCapacity(seconds, capacity int64) {
 
 // NewLimiter returns an in-proecss limiter.
 func NewLimiter() Limiter {
+	return NewLimiterWithClock(SystemClock)
+}
+
+// NewLimiterWithClock returns an in-process limiter that uses the given
+// clock for all timekeeping. This is mainly useful for tests.
+func NewLimiterWithClock(c Clock) Limiter {
 	return &limiter{
-		methodWake: make(map[Invocation]time.Time),
+		clock:           c,
+		methodWake:      make(map[Invocation]time.Time),
+		serviceWake:     make(map[Invocation]time.Time),
+		serviceFailures: make(map[Invocation]int),
 	}
 }
 
@@ -122,11 +134,18 @@ type limiter struct {
 	// empty Method field corresponds to the application-level limits.
 	limits sync.Map
 
-	// lock protects methodWake. The empty method corresponds to application
-	// limits. Service limits are also included as application limits, since they
-	// have the same underlying effect.
+	// lock protects methodWake, serviceWake and serviceFailures. The empty
+	// method in methodWake corresponds to application limits.
 	lock       sync.RWMutex
 	methodWake map[Invocation]time.Time
+
+	// serviceWake and serviceFailures track service rate limits, which are
+	// enforced by the underlying service for a method and region regardless of
+	// the key, so they only block the affected invocation.
+	serviceWake     map[Invocation]time.Time
+	serviceFailures map[Invocation]int
+
+	clock Clock
 }
 
 // getInvocationLimit returns the limit corresponding to the given invocation.
@@ -142,7 +161,7 @@ func (l *limiter) getInvocationLimit(inv Invocation) *invocationLimit {
 // getOrCreateInvocationLimit returns the limit corresponding to the given
 // invocation. If it does not yet exist, then create one and return it.
 func (l *limiter) getOrCreateInvocationLimit(inv Invocation) *invocationLimit {
-	val, _ := l.limits.LoadOrStore(inv, &invocationLimit{})
+	val, _ := l.limits.LoadOrStore(inv, &invocationLimit{clock: l.clock})
 	return val.(*invocationLimit)
 }
 
@@ -152,25 +171,43 @@ func (l *limiter) maybeSleep(ctx context.Context, inv Invocation) error {
 	l.lock.RLock()
 	appWake := l.methodWake[inv.App()]
 	methodWake := l.methodWake[inv]
+	serviceWake := l.serviceWake[inv]
 	l.lock.RUnlock()
 
 	if !appWake.IsZero() {
-		select {
-		case <-time.NewTimer(time.Until(appWake)).C:
-		case <-ctx.Done():
-			return ctx.Err()
+		err := l.sleep(ctx, appWake.Sub(l.clock.Now()))
+		if err != nil {
+			return err
 		}
 	}
 	if !methodWake.IsZero() {
-		select {
-		case <-time.NewTimer(time.Until(methodWake)).C:
-		case <-ctx.Done():
-			return ctx.Err()
+		err := l.sleep(ctx, methodWake.Sub(l.clock.Now()))
+		if err != nil {
+			return err
+		}
+	}
+	if !serviceWake.IsZero() {
+		err := l.sleep(ctx, serviceWake.Sub(l.clock.Now()))
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// sleep returns after either the duration has passed or the context is
+// cancelled.
+func (l *limiter) sleep(ctx context.Context, d time.Duration) error {
+	t := l.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // setCapacityForInvocation takes an HTTP header containing rate capacities and
 // stores these capacitites in the limits structure corresponding to the given
 // invocation.
@@ -272,10 +309,8 @@ func (l *limiter) Acquire(ctx context.Context, inv Invocation) (Done, Cancel, er
 			cancelAllAcquired(appAcquired)
 		}
 		// Sleep before retrying, up until cancellation.
-		select {
-		case <-time.NewTimer(sleepBeforeRetryAcquire).C:
-		case <-ctx.Done():
-			return nil, nil, ctx.Err()
+		if err := l.sleep(ctx, sleepBeforeRetryAcquire); err != nil {
+			return nil, nil, err
 		}
 	}
 
@@ -321,12 +356,21 @@ func (l *limiter) Acquire(ctx context.Context, inv Invocation) (Done, Cancel, er
 					return err
 				}
 			}
+			var retry time.Duration
 			if retryAfter != "" {
 				retrySeconds, err := strconv.ParseInt(retryAfter, 10, 64)
 				if err != nil {
 					return err
 				}
-				until := time.Now().Add(time.Duration(retrySeconds) * time.Second)
+				retry = time.Duration(retrySeconds) * time.Second
+			}
+			switch {
+			case isServiceLimited(res, retryType):
+				// Service limits back off only this invocation, since the
+				// application quota is unaffected.
+				l.backoffService(inv, retry)
+			case retryAfter != "":
+				until := l.clock.Now().Add(retry)
 				var sleepKey Invocation
 				// Method sleeps are tied to this specific invocation.
 				if retryType == "method" {
@@ -339,6 +383,8 @@ func (l *limiter) Acquire(ctx context.Context, inv Invocation) (Done, Cancel, er
 					l.methodWake[sleepKey] = until
 				}
 				l.lock.Unlock()
+			default:
+				l.resetService(inv)
 			}
 		}
 		return nil
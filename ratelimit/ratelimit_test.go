@@ -0,0 +1,272 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/ratelimittest"
+)
+
+// advanceUntil advances the clock in small steps until the finished channel
+// is closed. Before each step, it waits until the given number of goroutines
+// are blocked on the clock.
+func advanceUntil(clock *ratelimittest.FakeClock, blocked func() int, finished <-chan struct{}) {
+	for {
+		select {
+		case <-finished:
+			return
+		default:
+		}
+		if clock.Waiters() < blocked() {
+			runtime.Gosched()
+			continue
+		}
+		clock.Advance(10 * time.Millisecond)
+	}
+}
+
+// simulate runs workers that make calls through the limiter until the total
+// number of calls is reached, advancing the clock in small steps.
+func simulate(t *testing.T, clock *ratelimittest.FakeClock, l ratelimit.Limiter, s *ratelimittest.Server, workers, calls int, methods ...string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		remaining = int64(calls)
+		active    = int64(workers)
+		wg        sync.WaitGroup
+		errs      = make(chan error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		method := methods[i%len(methods)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer atomic.AddInt64(&active, -1)
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				done, _, err := l.Acquire(ctx, ratelimit.Invocation{
+					ApplicationKey: "key",
+					Region:         "NA1",
+					Method:         method,
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := done(s.Call(method)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	advanceUntil(clock, func() int {
+		return int(atomic.LoadInt64(&active))
+	}, finished)
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestSimulatedAppLimits(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	s, err := ratelimittest.NewServer(clock, "20:1,100:120", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ratelimit.NewLimiterWithClock(clock)
+
+	// Learn the limits from a single call before applying concurrent load.
+	simulate(t, clock, l, s, 1, 1, "/foo")
+	simulate(t, clock, l, s, 8, 249, "/foo", "/bar")
+
+	if got := s.Requests(); got != 250 {
+		t.Errorf("got %d requests, want 250", got)
+	}
+	if got := s.Violations(); got != 0 {
+		t.Errorf("got %d rate limit violations, want 0", got)
+	}
+	// 250 calls at 100 per 120 seconds require at least two full windows.
+	if elapsed := clock.Now().Sub(time.Unix(0, 0)); elapsed < 240*time.Second {
+		t.Errorf("250 calls finished after %v, faster than the limits allow", elapsed)
+	}
+}
+
+func TestSimulatedMethodLimits(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	s, err := ratelimittest.NewServer(clock, "20:1,100:120", "5:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ratelimit.NewLimiterWithClock(clock)
+
+	simulate(t, clock, l, s, 1, 1, "/foo")
+	simulate(t, clock, l, s, 4, 29, "/foo")
+
+	if got := s.Violations(); got != 0 {
+		t.Errorf("got %d rate limit violations, want 0", got)
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	s, err := ratelimittest.NewServer(clock, "20:1,100:120", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ratelimit.NewLimiterWithClock(clock)
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+		Method:         "/foo",
+	}
+	q := l.(ratelimit.QuotaReporter)
+
+	if got := q.Available(inv.App()); got != -1 {
+		t.Errorf("got %d available before the first call, want -1", got)
+	}
+	for i := 0; i < 5; i++ {
+		done, _, err := l.Acquire(context.Background(), inv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := done(s.Call(inv.Method)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := q.Available(inv.App()); got != 15 {
+		t.Errorf("got %d available, want 15", got)
+	}
+	if got := q.Capacity(inv.App()); got != 20 {
+		t.Errorf("got capacity %d, want 20", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	l := ratelimit.NewLimiterWithClock(clock)
+	ctx := context.Background()
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+		Method:         "/foo",
+	}
+
+	done, _, err := l.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &http.Response{Header: make(http.Header)}
+	res.Header.Set("Retry-After", "10")
+	res.Header.Set("X-Rate-Limit-Type", "method")
+	if err := done(res); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		done, _, err := l.Acquire(ctx, inv)
+		if err == nil {
+			done(nil)
+		}
+		close(acquired)
+	}()
+
+	advanceUntil(clock, func() int { return 1 }, acquired)
+	if clock.Now().Before(time.Unix(10, 0)) {
+		t.Fatalf("acquired at %v during the retry penalty", clock.Now())
+	}
+}
+
+func TestServiceRateLimit(t *testing.T) {
+	clock := ratelimittest.NewFakeClock(time.Unix(0, 0))
+	l := ratelimit.NewLimiterWithClock(clock)
+	ctx := context.Background()
+	foo := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+		Method:         "/foo",
+	}
+	bar := foo
+	bar.Method = "/bar"
+
+	serviceState := func() ratelimit.InvocationState {
+		for _, st := range l.(ratelimit.Inspector).Inspect() {
+			if st.Invocation == foo {
+				return st
+			}
+		}
+		return ratelimit.InvocationState{}
+	}
+
+	// Consecutive service violations back off exponentially.
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		start := clock.Now()
+		acquired := make(chan struct{})
+		go func() {
+			done, _, err := l.Acquire(ctx, foo)
+			if err != nil {
+				t.Error(err)
+			} else {
+				res := &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header:     make(http.Header),
+				}
+				res.Header.Set("X-Rate-Limit-Type", "service")
+				done(res)
+			}
+			close(acquired)
+		}()
+		advanceUntil(clock, func() int { return 1 }, acquired)
+
+		st := serviceState()
+		if st.ServiceFailures != i+1 {
+			t.Errorf("got %d service failures, want %d", st.ServiceFailures, i+1)
+		}
+		if got := st.ServiceWake.Sub(clock.Now()); got != want {
+			t.Errorf("got service backoff %v, want %v", got, want)
+		}
+		if !st.Wake.IsZero() {
+			t.Errorf("got wake %v for service violation, want none", st.Wake)
+		}
+		if i > 0 && clock.Now().Sub(start) < want/2 {
+			t.Errorf("acquired after %v during the service backoff", clock.Now().Sub(start))
+		}
+	}
+
+	// Other methods of the same key are not affected.
+	done, _, err := l.Acquire(ctx, bar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := done(&http.Response{StatusCode: http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A successful call resets the backoff.
+	clock.Advance(time.Minute)
+	done, _, err = l.Acquire(ctx, foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := done(&http.Response{StatusCode: http.StatusOK}); err != nil {
+		t.Fatal(err)
+	}
+	if st := serviceState(); st.ServiceFailures != 0 {
+		t.Errorf("got %d service failures after success, want 0", st.ServiceFailures)
+	}
+}
@@ -0,0 +1,160 @@
+// Package ratelimittest provides a fake clock and a simulated Riot API server
+// for testing and simulating rate limiters without sleeping.
+//
+// A typical simulation constructs a FakeClock, a limiter using
+// ratelimit.NewLimiterWithClock, and a Server with the limits to enforce.
+// Workers acquire quota and call the Server, while the test repeatedly calls
+// Advance on the clock. The Server counts any call that exceeds its limits as
+// a violation.
+package ratelimittest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+// FakeClock is a ratelimit.Clock whose time only moves when Advance is
+// called. Unlike the system clock, functions scheduled with AfterFunc run
+// synchronously within Advance, so their effects are visible as soon as
+// Advance returns. FakeClock is threadsafe.
+type FakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	seq    int64
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+
+	// seq orders timers with the same deadline by creation.
+	seq int64
+
+	// Exactly one of c and f is set.
+	c chan time.Time
+	f func()
+}
+
+// NewFakeClock returns a clock starting at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// schedule adds the timer, or fires it immediately if it has a channel and no
+// delay.
+func (c *FakeClock) schedule(t *fakeTimer, d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t.when = c.now.Add(d)
+	if d <= 0 && t.c != nil {
+		t.c <- c.now
+		return
+	}
+	c.seq++
+	t.seq = c.seq
+	c.timers = append(c.timers, t)
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) ratelimit.Timer {
+	t := &fakeTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+	}
+	c.schedule(t, d)
+	return t
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ratelimit.Timer {
+	t := &fakeTimer{
+		clock: c,
+		f:     f,
+	}
+	c.schedule(t, d)
+	return t
+}
+
+// Pending returns the number of timers that have not fired or been stopped.
+func (c *FakeClock) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+// Waiters returns the number of pending timers created by NewTimer, which
+// usually corresponds to the number of goroutines blocked on the clock.
+// Simulations can wait until all workers are blocked before calling Advance.
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if t.c != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Advance moves the clock forward by the duration, firing all timers that are
+// due in deadline order. The clock reads each timer's deadline while it
+// fires.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	end := c.now.Add(d)
+	c.lock.Unlock()
+
+	for {
+		c.lock.Lock()
+		sort.Slice(c.timers, func(i, j int) bool {
+			if !c.timers[i].when.Equal(c.timers[j].when) {
+				return c.timers[i].when.Before(c.timers[j].when)
+			}
+			return c.timers[i].seq < c.timers[j].seq
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			c.now = end
+			c.lock.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		now := c.now
+		c.lock.Unlock()
+
+		if t.c != nil {
+			t.c <- now
+		} else {
+			t.f()
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
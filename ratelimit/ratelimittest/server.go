@@ -0,0 +1,197 @@
+package ratelimittest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+// window is a fixed rate limit window, which starts with the first call after
+// the previous window ends.
+type window struct {
+	seconds  int64
+	capacity int64
+	start    time.Time
+	count    int64
+}
+
+// windows is a set of limits sorted by interval length.
+type windows []*window
+
+// parseWindows parses limits like "20:1,100:120".
+func parseWindows(spec string) (windows, error) {
+	var res windows
+	if strings.TrimSpace(spec) == "" {
+		return res, nil
+	}
+	for _, piece := range strings.Split(spec, ",") {
+		kv := strings.Split(strings.TrimSpace(piece), ":")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected K:V in %q", spec)
+		}
+		capacity, err := strconv.ParseInt(kv[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &window{
+			seconds:  seconds,
+			capacity: capacity,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].seconds < res[j].seconds
+	})
+	return res, nil
+}
+
+// copy returns unused windows with the same limits.
+func (ws windows) copy() windows {
+	res := make(windows, 0, len(ws))
+	for _, w := range ws {
+		res = append(res, &window{
+			seconds:  w.seconds,
+			capacity: w.capacity,
+		})
+	}
+	return res
+}
+
+// call counts a call at the given time, and returns the time until the
+// latest exceeded window resets, or zero if no window is exceeded.
+func (ws windows) call(now time.Time) time.Duration {
+	var retry time.Duration
+	for _, w := range ws {
+		end := w.start.Add(time.Duration(w.seconds) * time.Second)
+		if w.start.IsZero() || !now.Before(end) {
+			w.start = now
+			w.count = 0
+			end = now.Add(time.Duration(w.seconds) * time.Second)
+		}
+		w.count++
+		if w.count > w.capacity && end.Sub(now) > retry {
+			retry = end.Sub(now)
+		}
+	}
+	return retry
+}
+
+// limitHeader returns the limit header value, like "20:1,100:120".
+func (ws windows) limitHeader() string {
+	var pieces []string
+	for _, w := range ws {
+		pieces = append(pieces, fmt.Sprintf("%d:%d", w.capacity, w.seconds))
+	}
+	return strings.Join(pieces, ",")
+}
+
+// countHeader returns the count header value, like "1:1,1:120".
+func (ws windows) countHeader() string {
+	var pieces []string
+	for _, w := range ws {
+		pieces = append(pieces, fmt.Sprintf("%d:%d", w.count, w.seconds))
+	}
+	return strings.Join(pieces, ",")
+}
+
+// Server simulates the rate limiting behavior of the Riot API. Limits are
+// enforced per fixed window, like the real API, and every call that exceeds a
+// limit is answered with HTTP 429 and counted as a violation. Server is
+// threadsafe.
+type Server struct {
+	clock ratelimit.Clock
+
+	lock         sync.Mutex
+	app          windows
+	methodLimits windows
+	methods      map[string]windows
+	requests     int
+	violations   int
+}
+
+// NewServer returns a server enforcing the given application and per-method
+// limits, in the header format "COUNT:SECONDS,...", for example
+// "20:1,100:120". Either may be empty to disable the corresponding limits.
+func NewServer(clock ratelimit.Clock, appLimits, methodLimits string) (*Server, error) {
+	app, err := parseWindows(appLimits)
+	if err != nil {
+		return nil, err
+	}
+	method, err := parseWindows(methodLimits)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		clock:        clock,
+		app:          app,
+		methodLimits: method,
+		methods:      make(map[string]windows),
+	}, nil
+}
+
+// Call simulates a call to the given method, and returns the response with
+// rate limit headers as the Riot API would.
+func (s *Server) Call(method string) *http.Response {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.clock.Now()
+	mw, ok := s.methods[method]
+	if !ok {
+		mw = s.methodLimits.copy()
+		s.methods[method] = mw
+	}
+	s.requests++
+	appRetry := s.app.call(now)
+	methodRetry := mw.call(now)
+
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+	}
+	if len(s.app) > 0 {
+		res.Header.Set("X-App-Rate-Limit", s.app.limitHeader())
+		res.Header.Set("X-App-Rate-Limit-Count", s.app.countHeader())
+	}
+	if len(mw) > 0 {
+		res.Header.Set("X-Method-Rate-Limit", mw.limitHeader())
+		res.Header.Set("X-Method-Rate-Limit-Count", mw.countHeader())
+	}
+
+	retry, retryType := appRetry, "application"
+	if methodRetry > retry {
+		retry, retryType = methodRetry, "method"
+	}
+	if retry > 0 {
+		s.violations++
+		seconds := int64((retry + time.Second - 1) / time.Second)
+		res.StatusCode = http.StatusTooManyRequests
+		res.Header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+		res.Header.Set("X-Rate-Limit-Type", retryType)
+	}
+	res.Status = fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	return res
+}
+
+// Requests returns the total number of calls.
+func (s *Server) Requests() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests
+}
+
+// Violations returns the number of calls that exceeded a limit.
+func (s *Server) Violations() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.violations
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// serviceBackoffBase is the backoff after the first consecutive service
+	// rate limit violation. Each further violation doubles the backoff.
+	serviceBackoffBase = time.Second
+
+	// serviceBackoffMax is the maximum backoff following service rate limit
+	// violations, unless Riot requests a longer wait with Retry-After.
+	serviceBackoffMax = time.Minute
+)
+
+// StatusHeader is the header used by remote limiters to forward the HTTP
+// status of a Riot response along with its headers. The status is needed to
+// detect service rate limits, which are not always indicated by headers.
+const StatusHeader = "X-Riot-Status"
+
+// ForwardHeader returns the response headers with the status code included,
+// for use by remote limiters that only transmit headers. It returns nil if the
+// response is nil.
+func ForwardHeader(res *http.Response) http.Header {
+	if res == nil {
+		return nil
+	}
+	h := res.Header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	if res.StatusCode != 0 {
+		h.Set(StatusHeader, strconv.Itoa(res.StatusCode))
+	}
+	return h
+}
+
+// ResponseFromHeader is the inverse of ForwardHeader. It returns a response
+// with the given headers and forwarded status code, or nil if the header is
+// nil.
+func ResponseFromHeader(h http.Header) *http.Response {
+	if h == nil {
+		return nil
+	}
+	res := &http.Response{Header: h}
+	if status, err := strconv.Atoi(h.Get(StatusHeader)); err == nil {
+		res.StatusCode = status
+	}
+	return res
+}
+
+// isServiceLimited returns true if the response is a rate limit violation
+// that was enforced by the underlying service rather than by the application
+// or method limits of the key. Riot marks these with X-Rate-Limit-Type:
+// service, or omits the type altogether.
+func isServiceLimited(res *http.Response, retryType string) bool {
+	switch retryType {
+	case "application", "method":
+		return false
+	case "service":
+		return true
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.Header.Get("Retry-After") != ""
+}
+
+// serviceBackoff returns the wait following the given number of consecutive
+// service rate limit violations.
+func serviceBackoff(failures int) time.Duration {
+	d := serviceBackoffBase
+	for i := 1; i < failures && d < serviceBackoffMax; i++ {
+		d *= 2
+	}
+	if d > serviceBackoffMax {
+		d = serviceBackoffMax
+	}
+	return d
+}
+
+// backoffService records a service rate limit violation for the invocation,
+// and blocks further acquisitions for the invocation with exponential backoff.
+// A longer retryAfter requested by Riot takes precedence.
+func (l *limiter) backoffService(inv Invocation, retryAfter time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.serviceFailures[inv]++
+	d := serviceBackoff(l.serviceFailures[inv])
+	if retryAfter > d {
+		d = retryAfter
+	}
+	until := l.clock.Now().Add(d)
+	if until.After(l.serviceWake[inv]) {
+		l.serviceWake[inv] = until
+	}
+}
+
+// resetService clears the consecutive service rate limit violations and the
+// backoff for the invocation after a call that was not rate limited.
+func (l *limiter) resetService(inv Invocation) {
+	l.lock.RLock()
+	_, ok := l.serviceFailures[inv]
+	l.lock.RUnlock()
+	if !ok {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.serviceFailures, inv)
+	delete(l.serviceWake, inv)
+}
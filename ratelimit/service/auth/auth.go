@@ -0,0 +1,216 @@
+// Package auth implements authentication between rate limit clients and the
+// rate limit server.
+//
+// Two schemes are supported. SharedSecret sends the secret itself as a bearer
+// token, and is intended for use over TLS. HMAC never sends the secret, and
+// instead sends a bearer token of the form
+//
+//	TIMESTAMP.NONCE.SIGNATURE
+//
+// where TIMESTAMP is the request time in Unix seconds, NONCE is a random hex
+// string, and SIGNATURE is the hex encoded HMAC-SHA256 of
+// "METHOD PATH TIMESTAMP NONCE BODY" keyed by the secret, and BODY is the hex
+// encoded SHA-256 of the request body. The server rejects tokens with
+// timestamps outside of the configured skew, and tokens whose nonce it has
+// already seen within that window, so a captured token cannot be replayed.
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSkew is the default tolerance for HMAC token timestamps.
+const DefaultMaxSkew = 5 * time.Minute
+
+var (
+	// ErrMissingToken is returned when the request has no bearer token.
+	ErrMissingToken = errors.New("missing bearer token")
+
+	// ErrInvalidToken is returned when the bearer token does not authenticate
+	// the request.
+	ErrInvalidToken = errors.New("invalid bearer token")
+)
+
+// Scheme signs outgoing client requests and verifies incoming server
+// requests.
+type Scheme interface {
+	// Sign adds credentials to the request.
+	Sign(req *http.Request) error
+
+	// Verify returns nil if the request carries valid credentials.
+	Verify(req *http.Request) error
+}
+
+// bearerToken returns the bearer token in the request Authorization header.
+func bearerToken(req *http.Request) (string, error) {
+	h := req.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(h, prefix) {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(h[len(prefix):]), nil
+}
+
+type sharedSecret struct {
+	secret string
+}
+
+// SharedSecret returns a scheme that authenticates requests carrying the given
+// secret as a bearer token.
+func SharedSecret(secret string) Scheme {
+	return &sharedSecret{secret: secret}
+}
+
+func (s *sharedSecret) Sign(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+s.secret)
+	return nil
+}
+
+func (s *sharedSecret) Verify(req *http.Request) error {
+	tok, err := bearerToken(req)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(tok), []byte(s.secret)) != 1 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+type hmacScheme struct {
+	secret  []byte
+	maxSkew time.Duration
+	now     func() time.Time
+
+	// seen maps the nonces of verified tokens to the time after which their
+	// timestamp is outside of the skew, and they can be forgotten. It holds
+	// one entry per request verified within twice the skew.
+	seenLock  sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// HMAC returns a scheme that authenticates requests using a time-limited HMAC
+// signature of the request method, path and body. If maxSkew is zero, then
+// DefaultMaxSkew is used. Each token is accepted once, so a scheme that
+// verifies requests must be shared by all handlers of the same server.
+func HMAC(secret []byte, maxSkew time.Duration) Scheme {
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	return &hmacScheme{
+		secret:  secret,
+		maxSkew: maxSkew,
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+	}
+}
+
+// bodyHash returns the hex encoded SHA-256 of the request body, and replaces
+// the body so that it can be read again.
+func bodyHash(req *http.Request) (string, error) {
+	var b []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		b, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// signature returns the hex encoded signature for the request at the given
+// Unix timestamp with the given nonce.
+func (h *hmacScheme) signature(req *http.Request, ts, nonce string) (string, error) {
+	body, err := bodyHash(req)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	fmt.Fprintf(mac, "%s %s %s %s %s", req.Method, req.URL.EscapedPath(), ts, nonce, body)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (h *hmacScheme) Sign(req *http.Request) error {
+	ts := strconv.FormatInt(h.now().Unix(), 10)
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	sig, err := h.signature(req, ts, nonce)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+ts+"."+nonce+"."+sig)
+	return nil
+}
+
+func (h *hmacScheme) Verify(req *http.Request) error {
+	tok, err := bearerToken(req)
+	if err != nil {
+		return err
+	}
+	pieces := strings.SplitN(tok, ".", 3)
+	if len(pieces) != 3 || pieces[1] == "" {
+		return ErrInvalidToken
+	}
+	secs, err := strconv.ParseInt(pieces[0], 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	now := h.now()
+	ts := time.Unix(secs, 0)
+	skew := now.Sub(ts)
+	if skew < -h.maxSkew || skew > h.maxSkew {
+		return ErrInvalidToken
+	}
+	want, err := h.signature(req, pieces[0], pieces[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(pieces[2]), []byte(want)) {
+		return ErrInvalidToken
+	}
+	if !h.firstUse(pieces[1], ts.Add(h.maxSkew), now) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// firstUse records the nonce until it expires, and returns false if it was
+// already recorded. Expired nonces are forgotten at most once per skew.
+func (h *hmacScheme) firstUse(nonce string, expires, now time.Time) bool {
+	h.seenLock.Lock()
+	defer h.seenLock.Unlock()
+	if now.Sub(h.lastSweep) > h.maxSkew {
+		for n, exp := range h.seen {
+			if now.After(exp) {
+				delete(h.seen, n)
+			}
+		}
+		h.lastSweep = now
+	}
+	if _, ok := h.seen[nonce]; ok {
+		return false
+	}
+	h.seen[nonce] = expires
+	return true
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRequest returns a signed request with the given body.
+func newRequest(t *testing.T, s Scheme, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest("POST", "http://localhost/acquire/key/NA1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// newHMAC returns an HMAC scheme whose clock is set by the returned function.
+func newHMAC(secret string) (*hmacScheme, func(time.Time)) {
+	h := HMAC([]byte(secret), time.Minute).(*hmacScheme)
+	now := time.Unix(1000, 0)
+	h.now = func() time.Time { return now }
+	return h, func(t time.Time) { now = t }
+}
+
+func TestSharedSecret(t *testing.T) {
+	req := newRequest(t, SharedSecret("secret"), "")
+	if err := SharedSecret("secret").Verify(req); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if err := SharedSecret("wrong").Verify(req); err != ErrInvalidToken {
+		t.Errorf("got %v with the wrong secret, want ErrInvalidToken", err)
+	}
+	req.Header.Del("Authorization")
+	if err := SharedSecret("secret").Verify(req); err != ErrMissingToken {
+		t.Errorf("got %v without a token, want ErrMissingToken", err)
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	client, _ := newHMAC("secret")
+	for _, tc := range []struct {
+		name   string
+		secret string
+		at     time.Time
+		tamper func(req *http.Request)
+		want   error
+	}{
+		{name: "valid", secret: "secret", at: time.Unix(1000, 0)},
+		{name: "bad signature", secret: "wrong", at: time.Unix(1000, 0), want: ErrInvalidToken},
+		{name: "small skew", secret: "secret", at: time.Unix(1059, 0)},
+		{name: "expired", secret: "secret", at: time.Unix(1061, 0), want: ErrInvalidToken},
+		{name: "future", secret: "secret", at: time.Unix(939, 0), want: ErrInvalidToken},
+		{
+			name:   "tampered body",
+			secret: "secret",
+			at:     time.Unix(1000, 0),
+			tamper: func(req *http.Request) {
+				req.Body = ioutil.NopCloser(strings.NewReader("method=/other"))
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name:   "tampered path",
+			secret: "secret",
+			at:     time.Unix(1000, 0),
+			tamper: func(req *http.Request) { req.URL.Path = "/acquire/other/NA1" },
+			want:   ErrInvalidToken,
+		},
+	} {
+		server, setNow := newHMAC(tc.secret)
+		setNow(tc.at)
+		req := newRequest(t, client, "method=/foo")
+		if tc.tamper != nil {
+			tc.tamper(req)
+		}
+		if err := server.Verify(req); err != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestHMACReplay(t *testing.T) {
+	client, setClientNow := newHMAC("secret")
+	server, setNow := newHMAC("secret")
+	req := newRequest(t, client, "method=/foo")
+	if err := server.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Verify(req); err != ErrInvalidToken {
+		t.Errorf("got %v replaying the token, want ErrInvalidToken", err)
+	}
+
+	// Nonces are forgotten once the skew check rejects their tokens.
+	setClientNow(time.Unix(1200, 0))
+	setNow(time.Unix(1200, 0))
+	if err := server.Verify(newRequest(t, client, "")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.seen); n != 1 {
+		t.Errorf("got %d remembered nonces, want 1", n)
+	}
+}
@@ -1,10 +1,13 @@
 // Package client implements rate limiting by connecting to a centralized rate
 // limiting server.
+//
+// Use New for one HTTP request per call, NewLeaser to additionally acquire
+// quota in batches, or NewStream to multiplex calls over one persistent
+// connection. Use NewSharded to spread quota across several server replicas.
 package client
 
 import (
 	"context"
-	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -12,6 +15,12 @@ import (
 
 	"github.com/Tilo-K/riot/external"
 	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/service/auth"
+)
+
+const (
+	formContentType = "application/x-www-form-urlencoded"
+	jsonContentType = "application/json"
 )
 
 // client implemnts the ratelimit.Limiter interface by querying a rate limit
@@ -19,13 +28,74 @@ import (
 type client struct {
 	base *url.URL
 	d    external.Doer
+
+	// auth signs outgoing requests. If nil, then requests are unsigned.
+	auth auth.Scheme
+
+	// hashKeys is true if the application key is sent as ratelimit.KeyID
+	// instead of the raw key.
+	hashKeys bool
 }
 
-// Acquire acquires quota for the given invocation. The caller must call done()
-// or cancel() within one minute of a successful call, or the quota will be
-// assumed to have been used, and will refresh after the maximum time.
-func (c *client) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelimit.Done, ratelimit.Cancel, error) {
-	address := c.base.String() + "/acquire/" + inv.ApplicationKey + "/" + inv.Region
+// Option configures the client returned by New.
+type Option func(*client)
+
+// WithAuth signs all requests to the server using the given scheme.
+func WithAuth(a auth.Scheme) Option {
+	return func(c *client) {
+		c.auth = a
+	}
+}
+
+// WithHashedKeys sends ratelimit.KeyID of the application key to the server
+// instead of the raw key, so that the key does not appear in URLs or access
+// logs. All clients sharing quota must agree on this setting.
+func WithHashedKeys() Option {
+	return func(c *client) {
+		c.hashKeys = true
+	}
+}
+
+// String returns the base URL of the server.
+func (c *client) String() string {
+	return c.base.String()
+}
+
+// post sends a POST request to the server at the given path. The content type
+// is only set if the body is non-empty.
+func (c *client) post(ctx context.Context, path string, contentType, body string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("POST", c.base.String()+path, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		// Clone so that signing does not modify the caller's header.
+		req.Header = header.Clone()
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.auth != nil {
+		if err := c.auth.Sign(req); err != nil {
+			return nil, err
+		}
+	}
+	req = req.WithContext(ctx)
+	return c.d.Do(req)
+}
+
+// invocationPath returns the /:API_KEY/:REGION path suffix for the
+// invocation.
+func (c *client) invocationPath(inv ratelimit.Invocation) string {
+	key := inv.ApplicationKey
+	if c.hashKeys {
+		key = ratelimit.KeyID(key)
+	}
+	return "/" + url.PathEscape(key) + "/" + url.PathEscape(inv.Region)
+}
+
+// invocationValues returns the form values describing the invocation.
+func (c *client) invocationValues(inv ratelimit.Invocation) url.Values {
 	values := url.Values(make(map[string][]string))
 	if inv.Method != "" {
 		values.Add("method", inv.Method)
@@ -36,12 +106,18 @@ func (c *client) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelim
 	if inv.NoAppQuota {
 		values.Add("noappquota", "T")
 	}
-	req, err := http.NewRequest("POST", address, strings.NewReader(values.Encode()))
-	if err != nil {
-		return nil, nil, err
+	if c.hashKeys {
+		values.Add("hashedkey", "T")
 	}
-	req = req.WithContext(ctx)
-	res, err := c.d.Do(req)
+	return values
+}
+
+// Acquire acquires quota for the given invocation. The caller must call done()
+// or cancel() within one minute of a successful call, or the quota will be
+// assumed to have been used, and will refresh after the maximum time.
+func (c *client) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelimit.Done, ratelimit.Cancel, error) {
+	values := c.invocationValues(inv)
+	res, err := c.post(ctx, "/acquire"+c.invocationPath(inv), formContentType, values.Encode(), nil)
 	err = getError(res, err)
 	if err != nil {
 		return nil, nil, err
@@ -54,35 +130,31 @@ func (c *client) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelim
 	token := string(tok)
 
 	done := func(res *http.Response) error {
-		address := c.base.String() + "/done/" + token
-		req, err := http.NewRequest("POST", address, nil)
-		if err != nil {
-			return err
-		}
-		if res != nil {
-			req.Header = res.Header
-		}
-		req = req.WithContext(ctx)
-		res, err = c.d.Do(req)
-		err = getError(res, err)
-		return err
+		res, err := c.post(ctx, "/done/"+token, "", "", ratelimit.ForwardHeader(res))
+		return closeError(res, err)
 	}
 
 	cancel := func() error {
-		address := c.base.String() + "/cancel/" + token
-		req, err := http.NewRequest("POST", address, nil)
-		if err != nil {
-			return err
-		}
-		req = req.WithContext(ctx)
-		res, err = c.d.Do(req)
-		err = getError(res, err)
-		return err
+		res, err := c.post(ctx, "/cancel/"+token, "", "", nil)
+		return closeError(res, err)
 	}
 
 	return done, cancel, nil
 }
 
+// StatusError is returned when the server responds with an HTTP error.
+type StatusError struct {
+	// StatusCode is the HTTP status returned by the server.
+	StatusCode int
+
+	// Message is the error message returned by the server.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
 // getError returns the error on bad response or if err is non-nil.
 func getError(res *http.Response, err error) error {
 	if err != nil {
@@ -94,16 +166,33 @@ func getError(res *http.Response, err error) error {
 		if err != nil {
 			return err
 		}
-		return errors.New(string(b))
+		return &StatusError{
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(b)),
+		}
 	}
 	return nil
 }
 
+// closeError is the same as getError, except the response body is always
+// closed.
+func closeError(res *http.Response, err error) error {
+	err = getError(res, err)
+	if err == nil {
+		res.Body.Close()
+	}
+	return err
+}
+
 // New returns a Limiter configured with the given http client (usually
 // http.DefaultClient) and base URL of the server.
-func New(doer external.Doer, base *url.URL) ratelimit.Limiter {
-	return &client{
+func New(doer external.Doer, base *url.URL, opts ...Option) ratelimit.Limiter {
+	c := &client{
 		d:    doer,
 		base: base,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/Tilo-K/riot/external"
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+var (
+	// ErrLeaseExhausted is returned when using more permits than were leased.
+	ErrLeaseExhausted = errors.New("all leased permits are used")
+
+	// ErrLeaseReleased is returned when using a lease after it is released.
+	ErrLeaseReleased = errors.New("lease is already released")
+)
+
+// Leaser is a Limiter that can also acquire permits in batches, saving a
+// round trip to the server per call.
+type Leaser interface {
+	ratelimit.Limiter
+
+	// Lease blocks until n permits for the invocation are acquired, or until
+	// the context is cancelled. The lease must be released within one minute,
+	// or all permits will be assumed to have been used.
+	Lease(ctx context.Context, inv ratelimit.Invocation, n int) (*Lease, error)
+}
+
+// Lease is a batch of permits for a single invocation. Call Use once for each
+// Riot API call made under the lease, and Release once all calls are
+// finished. Lease is threadsafe.
+type Lease struct {
+	c       *client
+	token   string
+	permits int
+
+	lock      sync.Mutex
+	responses []map[string][]string
+	released  bool
+}
+
+// Permits returns the number of permits in the lease.
+func (l *Lease) Permits() int {
+	return l.permits
+}
+
+// Remaining returns the number of permits that have not been used.
+func (l *Lease) Remaining() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.permits - len(l.responses)
+}
+
+// Use marks one permit as used. If the given response is non-nil, then its
+// headers are reported to the server on Release.
+func (l *Lease) Use(res *http.Response) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.released {
+		return ErrLeaseReleased
+	}
+	if len(l.responses) >= l.permits {
+		return ErrLeaseExhausted
+	}
+	var header map[string][]string
+	if res != nil {
+		header = ratelimit.ForwardHeader(res)
+	}
+	l.responses = append(l.responses, header)
+	return nil
+}
+
+// Release reports all used permits to the server in one call, and returns the
+// unused permits immediately.
+func (l *Lease) Release(ctx context.Context) error {
+	l.lock.Lock()
+	if l.released {
+		l.lock.Unlock()
+		return ErrLeaseReleased
+	}
+	l.released = true
+	body, err := json.Marshal(struct {
+		Responses []map[string][]string `json:"responses"`
+	}{l.responses})
+	l.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	res, err := l.c.post(ctx, "/release/"+l.token, jsonContentType, string(body), nil)
+	return closeError(res, err)
+}
+
+func (c *client) Lease(ctx context.Context, inv ratelimit.Invocation, n int) (*Lease, error) {
+	values := c.invocationValues(inv)
+	values.Add("count", strconv.Itoa(n))
+	res, err := c.post(ctx, "/lease"+c.invocationPath(inv), formContentType, values.Encode(), nil)
+	err = getError(res, err)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{
+		c:       c,
+		token:   string(bytes.TrimSpace(tok)),
+		permits: n,
+	}, nil
+}
+
+// NewLeaser is the same as New, except the returned value also supports
+// batch acquisition.
+func NewLeaser(doer external.Doer, base *url.URL, opts ...Option) Leaser {
+	return New(doer, base, opts...).(Leaser)
+}
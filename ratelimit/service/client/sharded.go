@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+const (
+	// virtualNodes is the number of points each replica occupies on the hash
+	// ring. More points spread buckets more evenly across replicas.
+	virtualNodes = 64
+
+	// replicaRetryInterval is how long a failed replica is skipped before it is
+	// tried again.
+	replicaRetryInterval = 10 * time.Second
+)
+
+// errNoReplicas is returned when acquiring from a client without replicas.
+var errNoReplicas = errors.New("no rate limit replicas configured")
+
+// ring is a consistent hash ring over replica indices. The points of each
+// replica are hashed from its name, so that adding, removing or reordering
+// replicas only moves the buckets of the affected replicas.
+type ring struct {
+	n      int
+	hashes []uint32
+	nodes  []int
+}
+
+type ringPoint struct {
+	hash uint32
+	node int
+}
+
+// newRing returns a ring over the replicas with the given names.
+func newRing(names []string) *ring {
+	n := len(names)
+	points := make([]ringPoint, 0, n*virtualNodes)
+	for node, name := range names {
+		for v := 0; v < virtualNodes; v++ {
+			h := crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(v)))
+			points = append(points, ringPoint{h, node})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+	r := &ring{n: n}
+	for _, p := range points {
+		r.hashes = append(r.hashes, p.hash)
+		r.nodes = append(r.nodes, p.node)
+	}
+	return r
+}
+
+// candidates returns all replica indices in ring order, starting from the
+// owner of the given key.
+func (r *ring) candidates(key string) []int {
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	var (
+		res  []int
+		seen = make(map[int]bool)
+	)
+	for i := 0; i < len(r.nodes) && len(res) < r.n; i++ {
+		node := r.nodes[(start+i)%len(r.nodes)]
+		if !seen[node] {
+			seen[node] = true
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+// replica is a single rate limit server.
+type replica struct {
+	l ratelimit.Limiter
+
+	lock      sync.Mutex
+	downUntil time.Time
+}
+
+func (r *replica) up() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return !time.Now().Before(r.downUntil)
+}
+
+func (r *replica) markDown() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.downUntil = time.Now().Add(replicaRetryInterval)
+}
+
+type shardedClient struct {
+	replicas []*replica
+	ring     *ring
+}
+
+// isUnavailable returns true if the error means the replica cannot serve
+// requests, as opposed to rejecting the specific request.
+func isUnavailable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// Acquire acquires quota from the replica that owns the invocation's
+// application key and region. If the owner is unavailable, then the next
+// replica on the ring is used.
+func (s *shardedClient) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelimit.Done, ratelimit.Cancel, error) {
+	candidates := s.ring.candidates(inv.ApplicationKey + "/" + inv.Region)
+
+	// Prefer replicas that are believed to be up, but fall back to the rest
+	// rather than failing outright.
+	var ordered []int
+	for _, i := range candidates {
+		if s.replicas[i].up() {
+			ordered = append(ordered, i)
+		}
+	}
+	for _, i := range candidates {
+		if !s.replicas[i].up() {
+			ordered = append(ordered, i)
+		}
+	}
+
+	err := errNoReplicas
+	for _, i := range ordered {
+		var (
+			done   ratelimit.Done
+			cancel ratelimit.Cancel
+		)
+		done, cancel, err = s.replicas[i].l.Acquire(ctx, inv)
+		if err == nil {
+			return done, cancel, nil
+		}
+		if ctx.Err() != nil || !isUnavailable(err) {
+			return nil, nil, err
+		}
+		s.replicas[i].markDown()
+	}
+	return nil, nil, err
+}
+
+// Inspect returns the combined state of all replicas that support
+// introspection.
+func (s *shardedClient) Inspect() []ratelimit.InvocationState {
+	var res []ratelimit.InvocationState
+	for _, r := range s.replicas {
+		if in, ok := r.l.(ratelimit.Inspector); ok {
+			res = append(res, in.Inspect()...)
+		}
+	}
+	return res
+}
+
+// Available returns the remaining quota of the invocation as reported by the
+// replica that owns it, or -1 if the replica does not report quota.
+func (s *shardedClient) Available(inv ratelimit.Invocation) int64 {
+	if q := s.owner(inv); q != nil {
+		return q.Available(inv)
+	}
+	return -1
+}
+
+// Capacity returns the smallest capacity of the invocation's limits as
+// reported by the replica that owns it, or -1 if the replica does not report
+// quota.
+func (s *shardedClient) Capacity(inv ratelimit.Invocation) int64 {
+	if q := s.owner(inv); q != nil {
+		return q.Capacity(inv)
+	}
+	return -1
+}
+
+// owner returns the replica that owns the invocation, if it reports quota.
+func (s *shardedClient) owner(inv ratelimit.Invocation) ratelimit.QuotaReporter {
+	candidates := s.ring.candidates(inv.ApplicationKey + "/" + inv.Region)
+	if len(candidates) == 0 {
+		return nil
+	}
+	q, _ := s.replicas[candidates[0]].l.(ratelimit.QuotaReporter)
+	return q
+}
+
+// NewSharded returns a Limiter that partitions quota across several rate
+// limit server replicas, such as those returned by New or NewStream. Each
+// (application key, region) bucket is owned by one replica chosen by
+// consistent hashing, so all clients configured with the same replicas agree
+// on the owner. Done and Cancel are always sent to the replica that granted
+// the quota.
+//
+// Replicas are placed on the ring by name: the server URL for limiters
+// returned by New or NewStream, or the String method of other limiters that
+// implement fmt.Stringer. Adding, removing or reordering replicas then only
+// moves the buckets of the affected replicas. Limiters without a name are
+// placed by their position in the list.
+//
+// If the owner is unreachable or draining, then the bucket fails over to the
+// next replica on the ring, and the failed replica is skipped for a short
+// period before it is tried again. The new owner starts without knowledge of
+// the bucket, and learns the limits from subsequent Riot responses.
+func NewSharded(replicas ...ratelimit.Limiter) ratelimit.Limiter {
+	s := &shardedClient{}
+	names := make([]string, 0, len(replicas))
+	for i, l := range replicas {
+		s.replicas = append(s.replicas, &replica{l: l})
+		if st, ok := l.(fmt.Stringer); ok {
+			names = append(names, st.String())
+		} else {
+			names = append(names, strconv.Itoa(i))
+		}
+	}
+	s.ring = newRing(names)
+	return s
+}
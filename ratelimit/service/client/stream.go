@@ -0,0 +1,445 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/external"
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/service/stream"
+)
+
+var (
+	// ErrStreamClosed is returned when using a Stream after Close.
+	ErrStreamClosed = errors.New("stream is closed")
+
+	// errStreamBroken is returned for requests that were pending when the
+	// connection to the server was lost.
+	errStreamBroken = errors.New("stream connection lost")
+)
+
+// Stream is a Limiter that sends all requests over a single persistent
+// connection to the server, instead of one HTTP request per call. The
+// connection is established on first use, and re-established if it is lost.
+// Stream also reports the limits pushed by the server via Inspect and
+// Available.
+//
+// The stream uses an HTTP/1.1 connection upgrade, so the Doer must not
+// negotiate HTTP/2 with the server.
+type Stream interface {
+	ratelimit.Limiter
+	ratelimit.Inspector
+	ratelimit.QuotaReporter
+	io.Closer
+}
+
+// streamConnection is a single connection to the server.
+type streamConnection struct {
+	rwc io.ReadWriteCloser
+
+	writeLock sync.Mutex
+	enc       *json.Encoder
+
+	// lock protects pending and broken.
+	lock    sync.Mutex
+	pending map[uint64]chan stream.Message
+	broken  bool
+}
+
+// register returns a channel that receives the response for the request ID.
+func (sc *streamConnection) register(id uint64) (chan stream.Message, error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if sc.broken {
+		return nil, errStreamBroken
+	}
+	ch := make(chan stream.Message, 1)
+	sc.pending[id] = ch
+	return ch, nil
+}
+
+func (sc *streamConnection) send(m stream.Message) error {
+	sc.writeLock.Lock()
+	defer sc.writeLock.Unlock()
+	return sc.enc.Encode(m)
+}
+
+// dispatch delivers a response to the pending request with the same ID.
+func (sc *streamConnection) dispatch(m stream.Message) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if ch, ok := sc.pending[m.ID]; ok {
+		ch <- m
+		close(ch)
+		delete(sc.pending, m.ID)
+	}
+}
+
+// fail marks the connection broken and fails all pending requests.
+func (sc *streamConnection) fail() {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	sc.broken = true
+	for id, ch := range sc.pending {
+		close(ch)
+		delete(sc.pending, id)
+	}
+	sc.rwc.Close()
+}
+
+type streamClient struct {
+	c *client
+
+	// ctx governs the lifetime of all connections, and is cancelled on Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// lock protects conn, nextID, closed, dialing and dialErr. dialing is
+	// closed once the dial in progress, if any, has finished with dialErr.
+	lock    sync.Mutex
+	conn    *streamConnection
+	nextID  uint64
+	closed  bool
+	dialing chan struct{}
+	dialErr error
+
+	// limitsLock protects limits and keys. limits are keyed by the invocation
+	// as seen by the server. keys maps server application keys to raw keys.
+	limitsLock sync.RWMutex
+	limits     map[ratelimit.Invocation]ratelimit.InvocationState
+	keys       map[string]string
+}
+
+// dial opens a new connection to the server.
+func (s *streamClient) dial() (*streamConnection, error) {
+	req, err := http.NewRequest("GET", s.c.base.String()+"/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", stream.Protocol)
+	if s.c.auth != nil {
+		if err := s.c.auth.Sign(req); err != nil {
+			return nil, err
+		}
+	}
+	req = req.WithContext(s.ctx)
+	res, err := s.c.d.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		if err := getError(res, nil); err != nil {
+			return nil, err
+		}
+		res.Body.Close()
+		return nil, fmt.Errorf("stream upgrade failed with HTTP status %d", res.StatusCode)
+	}
+	rwc, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		res.Body.Close()
+		return nil, errors.New("stream upgrade returned a read-only body")
+	}
+	sc := &streamConnection{
+		rwc:     rwc,
+		enc:     json.NewEncoder(rwc),
+		pending: make(map[uint64]chan stream.Message),
+	}
+	go s.read(sc)
+	return sc, nil
+}
+
+// read processes server messages until the connection fails.
+func (s *streamClient) read(sc *streamConnection) {
+	dec := json.NewDecoder(sc.rwc)
+	for {
+		var m stream.Message
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		if m.Type == stream.Limits {
+			s.updateLimits(m.Limits)
+			continue
+		}
+		sc.dispatch(m)
+	}
+	sc.fail()
+
+	s.lock.Lock()
+	if s.conn == sc {
+		s.conn = nil
+	}
+	s.lock.Unlock()
+}
+
+// updateLimits stores limits pushed by the server.
+func (s *streamClient) updateLimits(limits []stream.InvocationLimits) {
+	s.limitsLock.Lock()
+	defer s.limitsLock.Unlock()
+	for _, l := range limits {
+		inv := ratelimit.Invocation{
+			ApplicationKey: l.Key,
+			Region:         l.Region,
+			Method:         l.Method,
+			Uniquifier:     l.Uniquifier,
+		}
+		st := ratelimit.InvocationState{
+			Invocation: inv,
+		}
+		for _, lim := range l.Limits {
+			st.Limits = append(st.Limits, ratelimit.LimitState{
+				Seconds:   lim.Seconds,
+				Capacity:  lim.Capacity,
+				Available: lim.Available,
+			})
+		}
+		if l.WakeUntil != nil {
+			st.Wake = *l.WakeUntil
+		}
+		if l.ServiceWakeUntil != nil {
+			st.ServiceWake = *l.ServiceWakeUntil
+		}
+		st.ServiceFailures = l.ServiceFailures
+		s.limits[inv] = st
+	}
+}
+
+// Inspect returns the limits most recently pushed by the server for
+// invocations made through this stream.
+func (s *streamClient) Inspect() []ratelimit.InvocationState {
+	s.limitsLock.RLock()
+	defer s.limitsLock.RUnlock()
+	res := make([]ratelimit.InvocationState, 0, len(s.limits))
+	for _, st := range s.limits {
+		if raw, ok := s.keys[st.Invocation.ApplicationKey]; ok {
+			st.Invocation.ApplicationKey = raw
+		}
+		res = append(res, st)
+	}
+	return res
+}
+
+// Available returns the remaining quota of the invocation according to the
+// limits most recently pushed by the server.
+func (s *streamClient) Available(inv ratelimit.Invocation) int64 {
+	return s.smallest(inv, true, func(lim ratelimit.LimitState) int64 { return lim.Available })
+}
+
+// Capacity returns the smallest capacity of the invocation's limits most
+// recently pushed by the server.
+func (s *streamClient) Capacity(inv ratelimit.Invocation) int64 {
+	return s.smallest(inv, false, func(lim ratelimit.LimitState) int64 { return lim.Capacity })
+}
+
+// smallest returns the smallest value of f over the pushed limits of the
+// invocation, or -1 if none were pushed. If wake is true, then 0 is returned
+// while a wake penalty is active.
+func (s *streamClient) smallest(inv ratelimit.Invocation, wake bool, f func(lim ratelimit.LimitState) int64) int64 {
+	if s.c.hashKeys {
+		inv.ApplicationKey = ratelimit.KeyID(inv.ApplicationKey)
+	}
+	inv.NoAppQuota = false
+	s.limitsLock.RLock()
+	st, ok := s.limits[inv]
+	s.limitsLock.RUnlock()
+	if !ok || len(st.Limits) == 0 {
+		return -1
+	}
+	if wake && st.Wake.After(time.Now()) {
+		return 0
+	}
+	res := f(st.Limits[0])
+	for _, lim := range st.Limits[1:] {
+		if v := f(lim); v < res {
+			res = v
+		}
+	}
+	return res
+}
+
+// String returns the base URL of the server.
+func (s *streamClient) String() string {
+	return s.c.String()
+}
+
+// connection returns the current connection, dialing if necessary. The dial
+// runs in the background, so that callers only wait for it until their
+// context is done, and concurrent callers share it.
+func (s *streamClient) connection(ctx context.Context) (*streamConnection, uint64, error) {
+	for {
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			return nil, 0, ErrStreamClosed
+		}
+		if s.conn != nil {
+			s.nextID++
+			sc, id := s.conn, s.nextID
+			s.lock.Unlock()
+			return sc, id, nil
+		}
+		if s.dialing == nil {
+			s.dialing = make(chan struct{})
+			go s.redial(s.dialing)
+		}
+		dialing := s.dialing
+		s.lock.Unlock()
+
+		select {
+		case <-dialing:
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+		s.lock.Lock()
+		sc, err := s.conn, s.dialErr
+		s.lock.Unlock()
+		if sc == nil && err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// redial dials a new connection, and then closes the dialing channel.
+func (s *streamClient) redial(dialing chan struct{}) {
+	sc, err := s.dial()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch {
+	case err != nil:
+	case s.closed:
+		sc.fail()
+		err = ErrStreamClosed
+	default:
+		s.conn = sc
+	}
+	s.dialErr = err
+	s.dialing = nil
+	close(dialing)
+}
+
+// call sends the request and waits for the response. If the context is
+// cancelled before the response arrives, then call returns immediately, and
+// the late response is passed to abandon, if non-nil.
+func (s *streamClient) call(ctx context.Context, m stream.Message, abandon func(stream.Message)) (stream.Message, error) {
+	sc, id, err := s.connection(ctx)
+	if err != nil {
+		return stream.Message{}, err
+	}
+	m.ID = id
+	ch, err := sc.register(id)
+	if err != nil {
+		return stream.Message{}, err
+	}
+	if err := sc.send(m); err != nil {
+		sc.fail()
+		return stream.Message{}, err
+	}
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return stream.Message{}, errStreamBroken
+		}
+		if res.Type == stream.Error {
+			return res, errors.New(res.Error)
+		}
+		return res, nil
+	case <-ctx.Done():
+		if abandon != nil {
+			go func() {
+				if res, ok := <-ch; ok {
+					abandon(res)
+				}
+			}()
+		}
+		return stream.Message{}, ctx.Err()
+	}
+}
+
+// finalize sends a done or cancel request for the token.
+func (s *streamClient) finalize(ctx context.Context, typ, token string, header http.Header) error {
+	_, err := s.call(ctx, stream.Message{
+		Type:   typ,
+		Token:  token,
+		Header: header,
+	}, nil)
+	return err
+}
+
+// Acquire acquires quota for the given invocation over the stream. The
+// caller must call done() or cancel() within one minute of a successful call,
+// or the quota will be assumed to have been used.
+func (s *streamClient) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelimit.Done, ratelimit.Cancel, error) {
+	key := inv.ApplicationKey
+	if s.c.hashKeys {
+		key = ratelimit.KeyID(key)
+	}
+	s.limitsLock.Lock()
+	s.keys[key] = inv.ApplicationKey
+	s.limitsLock.Unlock()
+
+	res, err := s.call(ctx, stream.Message{
+		Type:       stream.Acquire,
+		Key:        key,
+		Region:     inv.Region,
+		Method:     inv.Method,
+		Uniquifier: inv.Uniquifier,
+		NoAppQuota: inv.NoAppQuota,
+		HashedKey:  s.c.hashKeys,
+	}, func(late stream.Message) {
+		// The grant arrived after the caller gave up, so return the quota.
+		if late.Type == stream.Grant {
+			s.finalize(s.ctx, stream.Cancel, late.Token, nil)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	token := res.Token
+
+	done := func(res *http.Response) error {
+		return s.finalize(ctx, stream.Done, token, ratelimit.ForwardHeader(res))
+	}
+
+	cancel := func() error {
+		return s.finalize(ctx, stream.Cancel, token, nil)
+	}
+
+	return done, cancel, nil
+}
+
+// Close closes the connection to the server. Outstanding tokens remain valid
+// on the server until they time out.
+func (s *streamClient) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	s.closed = true
+	if s.conn != nil {
+		s.conn.fail()
+		s.conn = nil
+	}
+	s.cancel()
+	return nil
+}
+
+// NewStream returns a Stream configured with the given http client and base
+// URL of the server. Close the Stream when it is no longer needed.
+func NewStream(doer external.Doer, base *url.URL, opts ...Option) Stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &streamClient{
+		c:      New(doer, base, opts...).(*client),
+		ctx:    ctx,
+		cancel: cancel,
+		limits: make(map[ratelimit.Invocation]ratelimit.InvocationState),
+		keys:   make(map[string]string),
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// drainPollInterval is how often Drain checks for outstanding tokens.
+const drainPollInterval = 100 * time.Millisecond
+
+// errDraining is returned when acquiring quota from a draining server.
+var errDraining = errors.New("server is draining")
+
+// errorStatus returns the HTTP status code for an error returned while
+// acquiring quota.
+func errorStatus(err error) int {
+	if err == errDraining {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// untilStopping returns a context that is cancelled when either the given
+// context is done or the server starts draining. The caller must call the
+// returned cancel function once the context is no longer needed. Returns
+// errDraining if the server is already draining.
+func (s *server) untilStopping(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	select {
+	case <-s.stopping:
+		return nil, nil, errDraining
+	default:
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel, nil
+}
+
+// addStream registers an open stream connection, so that it is closed once
+// draining is complete. Returns errDraining if the server is draining.
+func (s *server) addStream(c io.Closer) error {
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	select {
+	case <-s.stopping:
+		return errDraining
+	default:
+	}
+	s.streams[c] = struct{}{}
+	return nil
+}
+
+// removeStream unregisters a stream connection.
+func (s *server) removeStream(c io.Closer) {
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	delete(s.streams, c)
+}
+
+// outstanding returns the number of tokens and leases that are not yet
+// finalized.
+func (s *server) outstanding() int {
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	return len(s.tokens) + len(s.leases)
+}
+
+// expireAll marks all outstanding tokens and leases done.
+func (s *server) expireAll() {
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	for k, got := range s.tokens {
+		got.done(nil)
+		delete(s.tokens, k)
+	}
+	for k, got := range s.leases {
+		got.expire()
+		delete(s.leases, k)
+	}
+}
+
+func (s *server) Drain(ctx context.Context) error {
+	s.stoppingOnce.Do(func() {
+		close(s.stopping)
+	})
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	var err error
+	for err == nil && s.outstanding() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	s.expireAll()
+
+	s.tokensLock.Lock()
+	for c := range s.streams {
+		c.Close()
+		delete(s.streams, c)
+	}
+	s.tokensLock.Unlock()
+	return err
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/gorilla/mux"
+)
+
+// maxLeaseCount is the largest number of permits that can be leased at once.
+const maxLeaseCount = 100
+
+// lease is a batch of acquisitions for the same invocation.
+type lease struct {
+	dones   []ratelimit.Done
+	cancels []ratelimit.Cancel
+	timer   *time.Timer
+
+	inv      ratelimit.Invocation
+	acquired time.Time
+}
+
+// release marks one permit as done for each of the given headers, and cancels
+// the remaining permits. A nil header marks the permit done without a
+// response.
+func (l *lease) release(headers []http.Header) error {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	var firstErr error
+	for i, done := range l.dones {
+		var err error
+		if i < len(headers) {
+			err = done(ratelimit.ResponseFromHeader(headers[i]))
+		} else {
+			err = l.cancels[i]()
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// expire marks all permits as done, as if they had all been used.
+func (l *lease) expire() {
+	l.release(make([]http.Header, len(l.dones)))
+}
+
+// releaseRequest is the JSON body of a release request.
+type releaseRequest struct {
+	Responses []map[string][]string `json:"responses"`
+}
+
+// leaseCapacity returns the smallest capacity of the known application and
+// method limits of the invocation, or -1 if none are known.
+func (s *server) leaseCapacity(inv ratelimit.Invocation) int64 {
+	q, ok := s.limiter.(ratelimit.QuotaReporter)
+	if !ok {
+		return -1
+	}
+	res := q.Capacity(inv)
+	if !inv.NoAppQuota {
+		if c := q.Capacity(inv.App()); c >= 0 && (res < 0 || c < res) {
+			res = c
+		}
+	}
+	return res
+}
+
+func (s *server) HandleLease(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.invocationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	count := 1
+	if c := r.Form.Get("count"); c != "" {
+		count, err = strconv.Atoi(c)
+		if err != nil || count < 1 || count > maxLeaseCount {
+			http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxLeaseCount), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Permits are acquired one at a time while holding the others, so a lease
+	// larger than a limit's capacity could never be granted.
+	if capacity := s.leaseCapacity(inv); capacity >= 0 && int64(count) > capacity {
+		http.Error(w, fmt.Sprintf("count %d exceeds the limit capacity of %d", count, capacity), http.StatusBadRequest)
+		return
+	}
+
+	ctx, stop, err := s.untilStopping(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	defer stop()
+
+	l := &lease{
+		inv: inv,
+	}
+	for i := 0; i < count; i++ {
+		done, cancel, err := s.limiter.Acquire(ctx, inv)
+		if err != nil {
+			for _, c := range l.cancels {
+				c()
+			}
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		l.dones = append(l.dones, done)
+		l.cancels = append(l.cancels, cancel)
+	}
+	l.acquired = time.Now()
+
+	s.tokensLock.Lock()
+	k, err := s.newTokenLocked()
+	if err != nil {
+		s.tokensLock.Unlock()
+		for _, c := range l.cancels {
+			c()
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.leases[k] = l
+
+	// Schedule automatic closing out.
+	l.timer = time.AfterFunc(s.timeout, func() {
+		s.tokensLock.Lock()
+		defer s.tokensLock.Unlock()
+
+		if got, ok := s.leases[k]; ok {
+			got.expire()
+			delete(s.leases, k)
+		}
+	})
+	s.tokensLock.Unlock()
+
+	fmt.Fprintf(w, "%s", k)
+}
+
+func (s *server) HandleRelease(w http.ResponseWriter, r *http.Request) {
+	var req releaseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	headers := make([]http.Header, len(req.Responses))
+	for i, res := range req.Responses {
+		if len(res) == 0 {
+			continue
+		}
+		// Canonicalize header names, since JSON keys are arbitrary strings.
+		h := make(http.Header)
+		for k, vs := range res {
+			for _, v := range vs {
+				h.Add(k, v)
+			}
+		}
+		headers[i] = h
+	}
+
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	token := mux.Vars(r)["token"]
+	got, ok := s.leases[token]
+	if !ok {
+		http.Error(w, errBadToken.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(headers) > len(got.dones) {
+		http.Error(w, fmt.Sprintf("got %d responses for %d permits", len(headers), len(got.dones)), http.StatusBadRequest)
+		return
+	}
+	delete(s.leases, token)
+	if err := got.release(headers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -6,22 +6,111 @@
 // Usage example:
 //
 //	ratelimit_server --port=8080
+//
+// To require authentication, set the RATELIMIT_SECRET environment variable and
+// choose a scheme:
+//
+//	RATELIMIT_SECRET=... ratelimit_server --port=8080 --auth=hmac
+//
+// On SIGTERM or SIGINT, the server stops granting quota and waits up to
+// --shutdown_timeout for outstanding tokens to be finalized. Tokens that are
+// still outstanding are then treated as done, and the server exits.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/Tilo-K/riot/ratelimit/service/auth"
 	"github.com/Tilo-K/riot/ratelimit/service/server"
 )
 
-var port = flag.Int("port", 8080, "server port")
+var (
+	port            = flag.Int("port", 8080, "server port, used if --addr is empty")
+	addr            = flag.String("addr", "", "listen address, for example localhost:8080. Overrides --port")
+	authScheme      = flag.String("auth", "none", "authentication scheme: none, secret or hmac. The secret is read from the RATELIMIT_SECRET environment variable")
+	tokenTimeout    = flag.Duration("token_timeout", server.DefaultTimeout, "time after which unfinalized tokens are considered done")
+	tlsCert         = flag.String("tls_cert", "", "TLS certificate file. If set, --tls_key must also be set")
+	tlsKey          = flag.String("tls_key", "", "TLS private key file")
+	readTimeout     = flag.Duration("read_timeout", 0, "maximum duration for reading a request, or zero for no limit")
+	writeTimeout    = flag.Duration("write_timeout", 0, "maximum duration for writing a response, or zero for no limit. Acquisitions block until quota is available, so this should be longer than the longest expected wait")
+	shutdownTimeout = flag.Duration("shutdown_timeout", server.DefaultTimeout, "maximum time to wait for outstanding tokens on shutdown")
+)
 
 func main() {
 	flag.Parse()
-	http.Handle("/", server.New())
-	log.Println("listening on port", *port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), nil))
+
+	opts := []server.Option{
+		server.WithTimeout(*tokenTimeout),
+	}
+	secret := os.Getenv("RATELIMIT_SECRET")
+	switch *authScheme {
+	case "none":
+	case "secret":
+		if secret == "" {
+			log.Fatal("RATELIMIT_SECRET must be set for --auth=secret")
+		}
+		opts = append(opts, server.WithAuth(auth.SharedSecret(secret)))
+	case "hmac":
+		if secret == "" {
+			log.Fatal("RATELIMIT_SECRET must be set for --auth=hmac")
+		}
+		opts = append(opts, server.WithAuth(auth.HMAC([]byte(secret), 0)))
+	default:
+		log.Fatalf("unknown auth scheme %q", *authScheme)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("--tls_cert and --tls_key must be set together")
+	}
+
+	listen := *addr
+	if listen == "" {
+		listen = fmt.Sprintf(":%d", *port)
+	}
+	s := server.NewServer(opts...)
+	srv := &http.Server{
+		Addr:         listen,
+		Handler:      s,
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Println("listening on", listen)
+		if *tlsCert != "" {
+			errs <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case sig := <-sigs:
+		log.Println("received", sig, "draining")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		log.Println("drain incomplete, outstanding tokens marked done:", err)
+	}
+	// Draining already waited for outstanding tokens, so only allow a short
+	// grace period for in-flight responses.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("shutdown:", err)
+	}
 }
@@ -4,8 +4,9 @@
 //	POST /acquire/:API_KEY/:REGION
 //		 Returns a unique string token that can be used to finalize or cancel
 //		 the quota request. If this method returns HTTP OK, then the token must
-//		 be marked either done or cancelled within one minute, or it is
-//		 considered timed out. The method supports the following form fields:
+//		 be marked either done or cancelled within the token timeout (one
+//		 minute by default), or it is considered timed out. The method
+//		 supports the following form fields:
 //
 //	    method: relative HTTP path to the Riot method. If omitted, then
 //	    	 the request refers to the application-level quota.
@@ -14,6 +15,8 @@
 //	    noappquota: if set to T or t, indicates that the request should count
 //	      towards (possibly uniquified) method-level quota, but not application
 //	      quota.
+//	    hashedkey: if set to T or t, indicates that :API_KEY is already
+//	      ratelimit.KeyID of the key, so that it is reported as is.
 //
 //	POST /done/:TOKEN
 //	  Marks the request with the given token as complete, so that all
@@ -25,42 +28,191 @@
 //	POST /cancel/:TOKEN
 //		 Marks the request with the given token as cancelled, so that all
 //		 relevant quota can be returned immediately.
+//
+//	POST /lease/:API_KEY/:REGION
+//		 Acquires a batch of permits for the same invocation in one call, and
+//		 returns a unique lease token. Supports the same form fields as
+//		 /acquire, and additionally:
+//
+//	    count: number of permits to acquire, between 1 and 100, and at most
+//	      the smallest capacity of the known limits. Defaults to 1.
+//
+//		 The lease must be released within the token timeout, or all permits
+//		 are considered used.
+//
+//	POST /release/:TOKEN
+//		 Releases the lease with the given token. The body is a JSON object of
+//		 the form {"responses": [HEADERS, ...]}, where each HEADERS is a map
+//		 from header name to list of values returned by the Riot API. Each
+//		 entry marks one permit as used, and may be empty if no response was
+//		 received. Permits without an entry are cancelled.
+//
+//	GET /stream
+//		 Upgrades the connection to a persistent stream, over which the client
+//		 can send acquire, done and cancel requests without a round trip per
+//		 connection, and receives pushes of updated limits. See the
+//		 ratelimit/service/stream package for the message format.
+//
+// The server also has the following read-only methods for operators. Keys are
+// never returned in plain text, and are instead identified by
+// ratelimit.KeyID.
+//
+//	GET /healthz
+//		 Returns HTTP OK if the server is serving.
+//
+//	GET /status/keys
+//		 Returns a JSON list of known application keys and their regions.
+//
+//	GET /status/limits
+//		 Returns a JSON list of all tracked invocations, including configured
+//		 limits, current usage and active wake penalties.
+//
+//	GET /status/tokens
+//		 Returns a JSON list of acquired tokens and leases that are not yet
+//		 done, cancelled or released.
+//
+// If the server is configured WithAuth, then every method except /healthz
+// requires credentials according to the given auth.Scheme, and unauthenticated
+// requests fail with HTTP Unauthorized.
+//
+// While the server is draining (see Server.Drain), /acquire, /lease and
+// /stream fail with HTTP Service Unavailable, so clients can retry against
+// another replica, but outstanding tokens can still be finalized.
+//
+// The :API_KEY path component is used only to separate quota buckets, so
+// clients may send ratelimit.KeyID of the key instead of the raw key, as long
+// as all clients sharing quota do the same. Such clients set the hashedkey
+// form field, so that the status methods report the keys as they were sent.
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/service/auth"
 	"github.com/gorilla/mux"
 	uuid "github.com/nu7hatch/gouuid"
 )
 
-const timeout = time.Minute
+// DefaultTimeout is the default time after which unfinalized tokens are
+// considered done.
+const DefaultTimeout = time.Minute
 
 // callbacksForToken contains the function callbacks that can be invoked for a
 // quota acquisition.
 type callbacksForToken struct {
 	done   ratelimit.Done
 	cancel ratelimit.Cancel
+
+	// inv and acquired describe the acquisition for introspection.
+	inv      ratelimit.Invocation
+	acquired time.Time
 }
 
 type server struct {
-	// tokens stores callbacks corresponding to unique tokens.
+	// tokens stores callbacks corresponding to unique tokens, and leases
+	// stores batches of acquisitions. Both are protected by tokensLock, and
+	// share the same token namespace.
 	tokens     map[string]*callbacksForToken
+	leases     map[string]*lease
 	tokensLock sync.Mutex
 
 	limiter ratelimit.Limiter
+
+	// auth verifies incoming requests. If nil, then all requests are allowed.
+	auth auth.Scheme
+
+	// timeout is the time after which unfinalized tokens are considered done.
+	timeout time.Duration
+
+	// stopping is closed when the server starts draining. streams holds open
+	// stream connections, which are closed once draining is complete, and is
+	// protected by tokensLock.
+	stopping     chan struct{}
+	stoppingOnce sync.Once
+	streams      map[io.Closer]struct{}
+
+	// hashedKeys holds the application keys that clients marked as already
+	// being ratelimit.KeyID of the key.
+	hashedKeysLock sync.RWMutex
+	hashedKeys     map[string]struct{}
+
+	// subscribers maps application-level invocations to the stream
+	// connections that acquired quota for them, which receive the updated
+	// limits whenever a done request changes them. It is protected by
+	// tokensLock.
+	subscribers map[ratelimit.Invocation]map[*streamConn]struct{}
 }
 
-func (s *server) HandleAcquire(w http.ResponseWriter, r *http.Request) {
+// Server is an http.Handler that implements the rate limit service, and can
+// be shut down gracefully.
+type Server interface {
+	http.Handler
+
+	// Drain stops granting quota, and waits until all outstanding tokens and
+	// leases are finalized or the context is done. Tokens and leases that are
+	// still outstanding when the context is done are marked done, as if all of
+	// their quota was used, and Drain returns the context error. Open streams
+	// are closed when Drain returns.
+	Drain(ctx context.Context) error
+}
+
+// Option configures the server returned by New.
+type Option func(*server)
+
+// WithTimeout sets the time after which unfinalized tokens and leases are
+// considered done. The default is DefaultTimeout. Durations that are not
+// positive would expire every token immediately, and are ignored.
+func WithTimeout(d time.Duration) Option {
+	return func(s *server) {
+		if d > 0 {
+			s.timeout = d
+		}
+	}
+}
+
+// WithAuth requires all requests other than health checks to be authenticated
+// using the given scheme.
+func WithAuth(a auth.Scheme) Option {
+	return func(s *server) {
+		s.auth = a
+	}
+}
+
+// authenticate is middleware that rejects requests that fail verification.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth != nil {
+			if err := s.auth.Verify(r); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// normalizeInvocation returns the invocation with canonical region and
+// method case.
+func normalizeInvocation(inv ratelimit.Invocation) ratelimit.Invocation {
+	inv.Region = strings.ToUpper(inv.Region)
+	inv.Method = strings.ToLower(inv.Method)
+	return inv
+}
+
+// invocationFromRequest parses the invocation described by the request path
+// and form, and records whether the key is marked as hashed.
+func (s *server) invocationFromRequest(r *http.Request) (ratelimit.Invocation, error) {
 	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ratelimit.Invocation{}, err
 	}
 
 	vars := mux.Vars(r)
@@ -69,19 +221,62 @@ func (s *server) HandleAcquire(w http.ResponseWriter, r *http.Request) {
 	method := r.Form.Get("method")
 	uniquifier := r.Form.Get("uniquifier")
 	noAppQuota := r.Form.Get("noappquota")
+	if hashed := r.Form.Get("hashedkey"); hashed == "t" || hashed == "T" {
+		s.markHashedKey(key)
+	}
 
-	inv := ratelimit.Invocation{
+	return normalizeInvocation(ratelimit.Invocation{
 		ApplicationKey: key,
-		Region:         strings.ToUpper(region),
-		Method:         strings.ToLower(method),
+		Region:         region,
+		Method:         method,
 		Uniquifier:     uniquifier,
 		NoAppQuota:     noAppQuota == "t" || noAppQuota == "T",
+	}), nil
+}
+
+// newTokenLocked returns a token that is not used by any outstanding
+// acquisition or lease. The caller must hold tokensLock.
+func (s *server) newTokenLocked() (string, error) {
+	for {
+		u, err := uuid.NewV4()
+		if err != nil {
+			return "", err
+		}
+		k := u.String()
+		if _, ok := s.tokens[k]; ok {
+			continue
+		}
+		if _, ok := s.leases[k]; ok {
+			continue
+		}
+		return k, nil
+	}
+}
+
+var (
+	// errBadToken is returned when finalizing a token that does not exist.
+	errBadToken = errors.New("bad token")
+
+	// errUnknownMessage is returned for stream messages of unknown type.
+	errUnknownMessage = errors.New("unknown message type")
+
+	// errTooManyInFlight is returned for stream messages received while the
+	// connection already has maxStreamInFlight messages in progress.
+	errTooManyInFlight = errors.New("too many messages in flight")
+)
+
+// acquire acquires quota for the invocation and returns a token that must be
+// marked done or cancelled within the timeout.
+func (s *server) acquire(ctx context.Context, inv ratelimit.Invocation) (string, error) {
+	ctx, stop, err := s.untilStopping(ctx)
+	if err != nil {
+		return "", err
 	}
+	defer stop()
 
-	done, cancel, err := s.limiter.Acquire(r.Context(), inv)
+	done, cancel, err := s.limiter.Acquire(ctx, inv)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
 	// Defined later in the same thread.
@@ -96,31 +291,21 @@ func (s *server) HandleAcquire(w http.ResponseWriter, r *http.Request) {
 			timer.Stop()
 			return cancel()
 		},
+		inv:      inv,
+		acquired: time.Now(),
 	}
 
-	var k string
-
-	for {
-		u, err := uuid.NewV4()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		k = u.String()
-
-		s.tokensLock.Lock()
-		if _, ok := s.tokens[k]; ok {
-			s.tokensLock.Unlock()
-			continue
-		}
-		s.tokens[k] = &callbacks
-		fmt.Fprintf(w, "%s", k)
-		s.tokensLock.Unlock()
-		break
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	k, err := s.newTokenLocked()
+	if err != nil {
+		cancel()
+		return "", err
 	}
+	s.tokens[k] = &callbacks
 
 	// Schedule automatic closing out.
-	timer = time.AfterFunc(timeout, func() {
+	timer = time.AfterFunc(s.timeout, func() {
 		s.tokensLock.Lock()
 		defer s.tokensLock.Unlock()
 
@@ -129,36 +314,60 @@ func (s *server) HandleAcquire(w http.ResponseWriter, r *http.Request) {
 			delete(s.tokens, k)
 		}
 	})
+	return k, nil
 }
 
-func (s *server) HandleDone(w http.ResponseWriter, r *http.Request) {
+// done marks the token as done, using rate limit information from the given
+// header if it is non-nil.
+func (s *server) done(token string, header http.Header) error {
 	s.tokensLock.Lock()
 	defer s.tokensLock.Unlock()
-	vars := mux.Vars(r)
-	token := vars["token"]
 	got, ok := s.tokens[token]
 	if !ok {
-		http.Error(w, "bad token", http.StatusBadRequest)
-		return
+		return errBadToken
 	}
-	got.done(&http.Response{
-		Header: r.Header,
-	})
 	delete(s.tokens, token)
+	return got.done(ratelimit.ResponseFromHeader(header))
 }
 
-func (s *server) HandleCancel(w http.ResponseWriter, r *http.Request) {
+// cancel marks the token as cancelled.
+func (s *server) cancel(token string) error {
 	s.tokensLock.Lock()
 	defer s.tokensLock.Unlock()
-	vars := mux.Vars(r)
-	token := vars["token"]
 	got, ok := s.tokens[token]
 	if !ok {
-		http.Error(w, "bad token", http.StatusBadRequest)
-		return
+		return errBadToken
 	}
-	got.cancel()
 	delete(s.tokens, token)
+	return got.cancel()
+}
+
+func (s *server) HandleAcquire(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.invocationFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	k, err := s.acquire(r.Context(), inv)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	fmt.Fprintf(w, "%s", k)
+}
+
+func (s *server) HandleDone(w http.ResponseWriter, r *http.Request) {
+	err := s.done(mux.Vars(r)["token"], r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (s *server) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	err := s.cancel(mux.Vars(r)["token"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
 }
 
 // New returns an HTTP handler that implements the rate limit service. The
@@ -166,14 +375,47 @@ func (s *server) HandleCancel(w http.ResponseWriter, r *http.Request) {
 //
 //			r := New()
 //	   http.Handle("/", r)
-func New() http.Handler {
-	s := server{
-		tokens:  make(map[string]*callbacksForToken),
-		limiter: ratelimit.NewLimiter(),
+func New(opts ...Option) http.Handler {
+	return NewServer(opts...)
+}
+
+// routedServer is a server with its routes.
+type routedServer struct {
+	*server
+	http.Handler
+}
+
+// NewServer is the same as New, except the returned value can be drained.
+func NewServer(opts ...Option) Server {
+	s := &server{
+		tokens:      make(map[string]*callbacksForToken),
+		leases:      make(map[string]*lease),
+		limiter:     ratelimit.NewLimiter(),
+		timeout:     DefaultTimeout,
+		stopping:    make(chan struct{}),
+		streams:     make(map[io.Closer]struct{}),
+		subscribers: make(map[ratelimit.Invocation]map[*streamConn]struct{}),
+		hashedKeys:  make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	r := mux.NewRouter()
-	r.HandleFunc("/acquire/{key}/{region}", s.HandleAcquire).Methods("POST")
-	r.HandleFunc("/done/{token}", s.HandleDone).Methods("POST")
-	r.HandleFunc("/cancel/{token}", s.HandleCancel).Methods("POST")
-	return r
+	r.HandleFunc("/healthz", s.HandleHealth).Methods("GET")
+
+	authed := r.NewRoute().Subrouter()
+	authed.Use(s.authenticate)
+	authed.HandleFunc("/acquire/{key}/{region}", s.HandleAcquire).Methods("POST")
+	authed.HandleFunc("/done/{token}", s.HandleDone).Methods("POST")
+	authed.HandleFunc("/cancel/{token}", s.HandleCancel).Methods("POST")
+	authed.HandleFunc("/lease/{key}/{region}", s.HandleLease).Methods("POST")
+	authed.HandleFunc("/release/{token}", s.HandleRelease).Methods("POST")
+	authed.HandleFunc("/stream", s.HandleStream).Methods("GET")
+	authed.HandleFunc("/status/keys", s.HandleKeys).Methods("GET")
+	authed.HandleFunc("/status/limits", s.HandleLimits).Methods("GET")
+	authed.HandleFunc("/status/tokens", s.HandleTokens).Methods("GET")
+	return routedServer{
+		server:  s,
+		Handler: r,
+	}
 }
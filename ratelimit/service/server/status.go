@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+)
+
+// keyStatus is the JSON representation of a known application key.
+type keyStatus struct {
+	KeyID   string   `json:"keyID"`
+	Regions []string `json:"regions"`
+}
+
+// limitStatus is the JSON representation of a single interval limit.
+type limitStatus struct {
+	Seconds   int64 `json:"seconds"`
+	Capacity  int64 `json:"capacity"`
+	Used      int64 `json:"used"`
+	Available int64 `json:"available"`
+}
+
+// invocationStatus is the JSON representation of an invocation. Empty Method
+// corresponds to application-level limits.
+type invocationStatus struct {
+	KeyID      string        `json:"keyID"`
+	Region     string        `json:"region"`
+	Method     string        `json:"method,omitempty"`
+	Uniquifier string        `json:"uniquifier,omitempty"`
+	Limits     []limitStatus `json:"limits"`
+	WakeUntil  *time.Time    `json:"wakeUntil,omitempty"`
+
+	// ServiceWakeUntil and ServiceFailures report backoff following service
+	// rate limit violations, separately from the limits of the key.
+	ServiceWakeUntil *time.Time `json:"serviceWakeUntil,omitempty"`
+	ServiceFailures  int        `json:"serviceFailures,omitempty"`
+}
+
+// tokenStatus is the JSON representation of an outstanding token or lease.
+type tokenStatus struct {
+	KeyID      string    `json:"keyID"`
+	Region     string    `json:"region"`
+	Method     string    `json:"method,omitempty"`
+	Uniquifier string    `json:"uniquifier,omitempty"`
+	NoAppQuota bool      `json:"noAppQuota,omitempty"`
+	Permits    int       `json:"permits"`
+	Lease      bool      `json:"lease,omitempty"`
+	Acquired   time.Time `json:"acquired"`
+	Expires    time.Time `json:"expires"`
+}
+
+// invocationLess orders invocations by key, region, method and uniquifier.
+func invocationLess(a, b ratelimit.Invocation) bool {
+	if a.ApplicationKey != b.ApplicationKey {
+		return a.ApplicationKey < b.ApplicationKey
+	}
+	if a.Region != b.Region {
+		return a.Region < b.Region
+	}
+	if a.Method != b.Method {
+		return a.Method < b.Method
+	}
+	return a.Uniquifier < b.Uniquifier
+}
+
+// inspect returns the sorted limiter state, or false if the limiter does not
+// support introspection.
+func (s *server) inspect() ([]ratelimit.InvocationState, bool) {
+	in, ok := s.limiter.(ratelimit.Inspector)
+	if !ok {
+		return nil, false
+	}
+	states := in.Inspect()
+	sort.Slice(states, func(i, j int) bool {
+		return invocationLess(states[i].Invocation, states[j].Invocation)
+	})
+	return states, true
+}
+
+// writeJSON writes the value as an indented JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// markHashedKey records that the application key is already ratelimit.KeyID
+// of the key.
+func (s *server) markHashedKey(key string) {
+	s.hashedKeysLock.RLock()
+	_, ok := s.hashedKeys[key]
+	s.hashedKeysLock.RUnlock()
+	if ok {
+		return
+	}
+	s.hashedKeysLock.Lock()
+	defer s.hashedKeysLock.Unlock()
+	s.hashedKeys[key] = struct{}{}
+}
+
+// keyID returns ratelimit.KeyID of the application key, or the key itself if
+// clients marked it as already hashed.
+func (s *server) keyID(key string) string {
+	s.hashedKeysLock.RLock()
+	defer s.hashedKeysLock.RUnlock()
+	if _, ok := s.hashedKeys[key]; ok {
+		return key
+	}
+	return ratelimit.KeyID(key)
+}
+
+func (s *server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+func (s *server) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	states, ok := s.inspect()
+	if !ok {
+		http.Error(w, "limiter does not support introspection", http.StatusNotImplemented)
+		return
+	}
+	regions := make(map[string]map[string]bool)
+	for _, st := range states {
+		id := s.keyID(st.Invocation.ApplicationKey)
+		if regions[id] == nil {
+			regions[id] = make(map[string]bool)
+		}
+		regions[id][st.Invocation.Region] = true
+	}
+	res := make([]keyStatus, 0, len(regions))
+	for id, rs := range regions {
+		k := keyStatus{KeyID: id}
+		for r := range rs {
+			k.Regions = append(k.Regions, r)
+		}
+		sort.Strings(k.Regions)
+		res = append(res, k)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].KeyID < res[j].KeyID
+	})
+	writeJSON(w, res)
+}
+
+func (s *server) HandleLimits(w http.ResponseWriter, r *http.Request) {
+	states, ok := s.inspect()
+	if !ok {
+		http.Error(w, "limiter does not support introspection", http.StatusNotImplemented)
+		return
+	}
+	res := make([]invocationStatus, 0, len(states))
+	for _, st := range states {
+		inv := invocationStatus{
+			KeyID:      s.keyID(st.Invocation.ApplicationKey),
+			Region:     st.Invocation.Region,
+			Method:     st.Invocation.Method,
+			Uniquifier: st.Invocation.Uniquifier,
+			Limits:     []limitStatus{},
+		}
+		sort.Slice(st.Limits, func(i, j int) bool {
+			return st.Limits[i].Seconds < st.Limits[j].Seconds
+		})
+		for _, lim := range st.Limits {
+			inv.Limits = append(inv.Limits, limitStatus{
+				Seconds:   lim.Seconds,
+				Capacity:  lim.Capacity,
+				Used:      lim.Used(),
+				Available: lim.Available,
+			})
+		}
+		if !st.Wake.IsZero() {
+			wake := st.Wake
+			inv.WakeUntil = &wake
+		}
+		if !st.ServiceWake.IsZero() {
+			wake := st.ServiceWake
+			inv.ServiceWakeUntil = &wake
+		}
+		inv.ServiceFailures = st.ServiceFailures
+		res = append(res, inv)
+	}
+	writeJSON(w, res)
+}
+
+func (s *server) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	s.tokensLock.Lock()
+	res := make([]tokenStatus, 0, len(s.tokens))
+	for _, cb := range s.tokens {
+		res = append(res, tokenStatus{
+			KeyID:      s.keyID(cb.inv.ApplicationKey),
+			Region:     cb.inv.Region,
+			Method:     cb.inv.Method,
+			Uniquifier: cb.inv.Uniquifier,
+			NoAppQuota: cb.inv.NoAppQuota,
+			Permits:    1,
+			Acquired:   cb.acquired,
+			Expires:    cb.acquired.Add(s.timeout),
+		})
+	}
+	for _, l := range s.leases {
+		res = append(res, tokenStatus{
+			KeyID:      s.keyID(l.inv.ApplicationKey),
+			Region:     l.inv.Region,
+			Method:     l.inv.Method,
+			Uniquifier: l.inv.Uniquifier,
+			NoAppQuota: l.inv.NoAppQuota,
+			Permits:    len(l.dones),
+			Lease:      true,
+			Acquired:   l.acquired,
+			Expires:    l.acquired.Add(s.timeout),
+		})
+	}
+	s.tokensLock.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Acquired.Before(res[j].Acquired)
+	})
+	writeJSON(w, res)
+}
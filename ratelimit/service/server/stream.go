@@ -0,0 +1,328 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/service/stream"
+)
+
+const (
+	// maxStreamInFlight is the maximum number of messages processed
+	// concurrently for a single stream connection.
+	maxStreamInFlight = 1024
+
+	// maxStreamPushes is the number of limit updates queued for a stream
+	// connection. A connection that falls further behind is closed.
+	maxStreamPushes = 64
+
+	// streamWriteTimeout bounds each write to a stream connection.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamConn serializes writes to a stream connection.
+type streamConn struct {
+	conn net.Conn
+
+	lock sync.Mutex
+	w    *bufio.Writer
+	enc  *json.Encoder
+
+	// pushes holds limit updates of other connections that are waiting to be
+	// sent.
+	pushes chan stream.Message
+
+	// buckets holds the application-level invocations the connection is
+	// subscribed to. It is protected by the server's tokensLock.
+	buckets map[ratelimit.Invocation]struct{}
+}
+
+func (c *streamConn) send(m stream.Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err := c.enc.Encode(m); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// push queues a limit update without blocking. If the queue is full, then the
+// connection is too slow to keep up and is closed.
+func (c *streamConn) push(m stream.Message) {
+	select {
+	case c.pushes <- m:
+	default:
+		c.conn.Close()
+	}
+}
+
+// writePushes sends queued limit updates until the context is done.
+func (c *streamConn) writePushes(ctx context.Context) {
+	for {
+		select {
+		case m := <-c.pushes:
+			if err := c.send(m); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe registers the connection for limit updates of the invocation's
+// application key and region.
+func (s *server) subscribe(c *streamConn, inv ratelimit.Invocation) {
+	app := inv.App()
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	subs, ok := s.subscribers[app]
+	if !ok {
+		subs = make(map[*streamConn]struct{})
+		s.subscribers[app] = subs
+	}
+	subs[c] = struct{}{}
+	c.buckets[app] = struct{}{}
+}
+
+// unsubscribe removes the connection from all limit updates.
+func (s *server) unsubscribe(c *streamConn) {
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	for app := range c.buckets {
+		delete(s.subscribers[app], c)
+		if len(s.subscribers[app]) == 0 {
+			delete(s.subscribers, app)
+		}
+	}
+	c.buckets = nil
+}
+
+// publish sends the current limits of the invocation to the given connection,
+// and queues them for every other connection subscribed to its application
+// key and region.
+func (s *server) publish(c *streamConn, inv ratelimit.Invocation) {
+	limits := s.limitsFor(inv)
+	if len(limits) == 0 {
+		return
+	}
+	m := stream.Message{
+		Type:   stream.Limits,
+		Limits: limits,
+	}
+	c.send(m)
+
+	s.tokensLock.Lock()
+	defer s.tokensLock.Unlock()
+	for sub := range s.subscribers[inv.App()] {
+		if sub != c {
+			sub.push(m)
+		}
+	}
+}
+
+// limitsFor returns the current limits tracked for the application and
+// method of the given invocation.
+func (s *server) limitsFor(inv ratelimit.Invocation) []stream.InvocationLimits {
+	var states []ratelimit.InvocationState
+	switch in := s.limiter.(type) {
+	case ratelimit.InvocationInspector:
+		for _, i := range []ratelimit.Invocation{inv.App(), inv} {
+			if st, ok := in.InspectInvocation(i); ok {
+				states = append(states, st)
+			}
+		}
+	case ratelimit.Inspector:
+		for _, st := range in.Inspect() {
+			if st.Invocation == inv.App() || st.Invocation == inv {
+				states = append(states, st)
+			}
+		}
+	}
+
+	var res []stream.InvocationLimits
+	for _, st := range states {
+		l := stream.InvocationLimits{
+			Key:        st.Invocation.ApplicationKey,
+			Region:     st.Invocation.Region,
+			Method:     st.Invocation.Method,
+			Uniquifier: st.Invocation.Uniquifier,
+		}
+		for _, lim := range st.Limits {
+			l.Limits = append(l.Limits, stream.Limit{
+				Seconds:   lim.Seconds,
+				Capacity:  lim.Capacity,
+				Available: lim.Available,
+			})
+		}
+		if !st.Wake.IsZero() {
+			wake := st.Wake
+			l.WakeUntil = &wake
+		}
+		if !st.ServiceWake.IsZero() {
+			wake := st.ServiceWake
+			l.ServiceWakeUntil = &wake
+		}
+		l.ServiceFailures = st.ServiceFailures
+		res = append(res, l)
+	}
+	return res
+}
+
+// handleStreamMessage processes one client request and sends the response.
+// Acquire requests may block, so the caller should run this concurrently.
+func (s *server) handleStreamMessage(ctx context.Context, c *streamConn, m stream.Message) {
+	reply := stream.Message{
+		Type: stream.OK,
+		ID:   m.ID,
+	}
+	var (
+		err    error
+		pushed ratelimit.Invocation
+		push   bool
+	)
+
+	switch m.Type {
+	case stream.Acquire:
+		inv := normalizeInvocation(ratelimit.Invocation{
+			ApplicationKey: m.Key,
+			Region:         m.Region,
+			Method:         m.Method,
+			Uniquifier:     m.Uniquifier,
+			NoAppQuota:     m.NoAppQuota,
+		})
+		if m.HashedKey {
+			s.markHashedKey(inv.ApplicationKey)
+		}
+		s.subscribe(c, inv)
+		reply.Type = stream.Grant
+		reply.Token, err = s.acquire(ctx, inv)
+	case stream.Done:
+		var header http.Header
+		if len(m.Header) > 0 {
+			header = make(http.Header)
+			for k, vs := range m.Header {
+				for _, v := range vs {
+					header.Add(k, v)
+				}
+			}
+		}
+		s.tokensLock.Lock()
+		if cb, ok := s.tokens[m.Token]; ok {
+			pushed, push = cb.inv, header != nil
+		}
+		s.tokensLock.Unlock()
+		err = s.done(m.Token, header)
+	case stream.Cancel:
+		err = s.cancel(m.Token)
+	default:
+		err = errUnknownMessage
+	}
+
+	if err != nil {
+		reply = stream.Message{
+			Type:  stream.Error,
+			ID:    m.ID,
+			Error: err.Error(),
+		}
+	}
+	// Push limits before the reply, so that they are visible to the client by
+	// the time its done request returns. Other streams using the same bucket
+	// learn about the new limits at the same time.
+	if err == nil && push {
+		s.publish(c, pushed)
+	}
+	c.send(reply)
+}
+
+func (s *server) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), stream.Protocol) {
+		http.Error(w, "expected Upgrade: "+stream.Protocol, http.StatusBadRequest)
+		return
+	}
+	select {
+	case <-s.stopping:
+		http.Error(w, errDraining.Error(), errorStatus(errDraining))
+		return
+	default:
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection does not support streaming", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	if err := s.addStream(conn); err != nil {
+		return
+	}
+	defer s.removeStream(conn)
+
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	buf.WriteString("Connection: Upgrade\r\n")
+	buf.WriteString("Upgrade: " + stream.Protocol + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		return
+	}
+
+	// Pending acquisitions are abandoned when the stream closes. Tokens that
+	// were already granted remain valid until done, cancelled or timed out.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &streamConn{
+		conn:    conn,
+		w:       buf.Writer,
+		enc:     json.NewEncoder(buf.Writer),
+		pushes:  make(chan stream.Message, maxStreamPushes),
+		buckets: make(map[ratelimit.Invocation]struct{}),
+	}
+	defer s.unsubscribe(c)
+	dec := json.NewDecoder(buf.Reader)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.writePushes(ctx)
+	}()
+	inFlight := make(chan struct{}, maxStreamInFlight)
+	for {
+		var m stream.Message
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			c.send(stream.Message{
+				Type:  stream.Error,
+				ID:    m.ID,
+				Error: errTooManyInFlight.Error(),
+			})
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-inFlight
+				wg.Done()
+			}()
+			s.handleStreamMessage(ctx, c, m)
+		}()
+	}
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/service/stream"
+)
+
+func TestStreamConnDropsSlowSubscriber(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	w := bufio.NewWriter(conn)
+	c := &streamConn{
+		conn:    conn,
+		w:       w,
+		enc:     json.NewEncoder(w),
+		pushes:  make(chan stream.Message, maxStreamPushes),
+		buckets: make(map[ratelimit.Invocation]struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.writePushes(ctx)
+
+	// The peer never reads, so the first write blocks and the queue fills.
+	finished := make(chan struct{})
+	go func() {
+		for i := 0; i < maxStreamPushes+2; i++ {
+			c.push(stream.Message{Type: stream.Limits})
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push blocked on a slow connection")
+	}
+
+	// The connection was closed, so the peer reads until EOF.
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(ioutil.Discard, peer); err != nil {
+		t.Errorf("got %v reading from the slow connection, want EOF", err)
+	}
+}
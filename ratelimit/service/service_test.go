@@ -2,12 +2,18 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Tilo-K/riot/ratelimit"
+	"github.com/Tilo-K/riot/ratelimit/service/auth"
 	"github.com/Tilo-K/riot/ratelimit/service/client"
 	"github.com/Tilo-K/riot/ratelimit/service/server"
 )
@@ -62,3 +68,665 @@ func TestEndToEnd(t *testing.T) {
 		t.Fatal("done should fail after cancel")
 	}
 }
+
+func TestStatus(t *testing.T) {
+	s := server.New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(http.DefaultClient, u)
+
+	ctx := context.Background()
+	_, cancel, err := c.Acquire(ctx, ratelimit.Invocation{
+		ApplicationKey: "secret-key",
+		Region:         "NA1",
+		Method:         "/foo/bar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	res, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("healthz returned %d", res.StatusCode)
+	}
+
+	res, err = http.Get(ts.URL + "/status/tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret-key") {
+		t.Fatalf("status leaks raw key: %s", b)
+	}
+	var tokens []struct {
+		KeyID  string `json:"keyID"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("got %d tokens, want 1", len(tokens))
+	}
+	if got, want := tokens[0].KeyID, ratelimit.KeyID("secret-key"); got != want {
+		t.Errorf("got key ID %q, want %q", got, want)
+	}
+	if got, want := tokens[0].Method, "/foo/bar"; got != want {
+		t.Errorf("got method %q, want %q", got, want)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("shared-secret")
+	s := server.New(server.WithAuth(auth.HMAC(secret, 0)))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+	}
+	ctx := context.Background()
+
+	unauthed := client.New(http.DefaultClient, u)
+	if _, _, err := unauthed.Acquire(ctx, inv); err == nil {
+		t.Fatal("unauthenticated acquire should fail")
+	}
+
+	wrong := client.New(http.DefaultClient, u, client.WithAuth(auth.HMAC([]byte("wrong"), 0)))
+	if _, _, err := wrong.Acquire(ctx, inv); err == nil {
+		t.Fatal("acquire with wrong secret should fail")
+	}
+
+	c := client.New(http.DefaultClient, u, client.WithAuth(auth.HMAC(secret, 0)), client.WithHashedKeys())
+	done, _, err := c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("X-App-Rate-Limit", "20:1")
+	header.Set("X-App-Rate-Limit-Count", "1:1")
+	if err := done(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+	// A raw key that looks like a KeyID is still hashed.
+	raw := ratelimit.Invocation{
+		ApplicationKey: "0123456789abcdef",
+		Region:         "NA1",
+	}
+	done, _, err = client.New(http.DefaultClient, u, client.WithAuth(auth.HMAC(secret, 0))).Acquire(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := done(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hashed keys are reported as sent, without hashing them again.
+	req, err := http.NewRequest("GET", ts.URL+"/status/keys", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.HMAC(secret, 0).Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []struct {
+		KeyID string `json:"keyID"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&keys)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		ratelimit.KeyID(inv.ApplicationKey): true,
+		ratelimit.KeyID(raw.ApplicationKey): true,
+	}
+	if len(keys) != len(want) || !want[keys[0].KeyID] || !want[keys[1].KeyID] {
+		t.Errorf("got keys %+v, want %v", keys, want)
+	}
+
+	// A signature cannot be replayed with a different body.
+	req, err = http.NewRequest("POST", ts.URL+"/acquire/key/NA1", strings.NewReader("method=/foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := auth.HMAC(secret, 0).Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	req.Body = ioutil.NopCloser(strings.NewReader("method=/bar"))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("replayed signature returned %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	res, err = http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("healthz returned %d", res.StatusCode)
+	}
+}
+
+func TestLease(t *testing.T) {
+	s := server.New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewLeaser(http.DefaultClient, u)
+
+	ctx := context.Background()
+	lease, err := c.Lease(ctx, ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+		Method:         "/foo/bar",
+	}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("X-App-Rate-Limit", "20:1,100:120")
+	header.Set("X-App-Rate-Limit-Count", "1:1,1:120")
+	if err := lease.Use(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Use(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lease.Remaining(), 1; got != want {
+		t.Errorf("got %d remaining permits, want %d", got, want)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Use(nil); err != client.ErrLeaseReleased {
+		t.Errorf("got %v using released lease, want %v", err, client.ErrLeaseReleased)
+	}
+
+	res, err := http.Get(ts.URL + "/status/limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limits []struct {
+		Method string `json:"method"`
+		Limits []struct {
+			Seconds  int64 `json:"seconds"`
+			Capacity int64 `json:"capacity"`
+		} `json:"limits"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&limits)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 1 || limits[0].Method != "" || len(limits[0].Limits) != 2 {
+		t.Fatalf("got limits %+v, want application limits from released headers", limits)
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := server.New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewStream(http.DefaultClient, u)
+	defer c.Close()
+
+	ctx := context.Background()
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+		Method:         "/foo/bar",
+	}
+	done, cancel, err := c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("X-App-Rate-Limit", "20:1,100:120")
+	header.Set("X-App-Rate-Limit-Count", "1:1,1:120")
+	if err := done(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cancel(); err == nil {
+		t.Fatal("cancel should fail after done")
+	}
+
+	states := c.Inspect()
+	if len(states) != 1 {
+		t.Fatalf("got %d pushed states, want 1", len(states))
+	}
+	if got, want := states[0].Invocation, inv.App(); got != want {
+		t.Errorf("got pushed invocation %+v, want %+v", got, want)
+	}
+	if got, want := len(states[0].Limits), 2; got != want {
+		t.Errorf("got %d pushed limits, want %d", got, want)
+	}
+
+	_, cancel, err = c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Acquire(ctx, inv); err != client.ErrStreamClosed {
+		t.Errorf("got %v after close, want %v", err, client.ErrStreamClosed)
+	}
+}
+
+func TestLeaseLargerThanCapacity(t *testing.T) {
+	s := server.New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewLeaser(http.DefaultClient, u)
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lease, err := c.Lease(ctx, inv, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("X-App-Rate-Limit", "20:1,100:120")
+	header.Set("X-App-Rate-Limit-Count", "1:1,1:120")
+	if err := lease.Use(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lease could never be granted, so it fails instead of blocking.
+	if _, err := c.Lease(ctx, inv, 21); err == nil || ctx.Err() != nil {
+		t.Errorf("got %v leasing more than the capacity, want an immediate error", err)
+	}
+	lease, err = c.Lease(ctx, inv, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamBroadcastsLimits(t *testing.T) {
+	s := server.New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := client.NewStream(http.DefaultClient, u)
+	defer a.Close()
+	b := client.NewStream(http.DefaultClient, u)
+	defer b.Close()
+
+	ctx := context.Background()
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+		Method:         "/foo/bar",
+	}
+	// The second stream uses the same bucket, but never reports limits.
+	_, cancel, err := b.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	done, _, err := a.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("X-App-Rate-Limit", "20:1,100:120")
+	header.Set("X-App-Rate-Limit-Count", "1:1,1:120")
+	if err := done(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); len(b.Inspect()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the second stream did not receive the updated limits")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := b.Available(inv.App()); got != 19 {
+		t.Errorf("got %d available on the second stream, want 19", got)
+	}
+}
+
+func TestStreamDialRespectsContext(t *testing.T) {
+	// The server never answers the upgrade.
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer ts.Close()
+	defer close(hang)
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewStream(http.DefaultClient, u)
+	defer c.Close()
+
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+	}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, _, err := c.Acquire(ctx, inv)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err != context.DeadlineExceeded {
+				t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("acquire blocked on the dial past its deadline")
+		}
+	}
+}
+
+func TestStreamInFlightLimit(t *testing.T) {
+	s := server.New()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewStream(http.DefaultClient, u)
+	defer c.Close()
+
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+	}
+	done, _, err := c.Acquire(context.Background(), inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	header.Set("X-App-Rate-Limit", "1:60")
+	header.Set("X-App-Rate-Limit-Count", "1:60")
+	if err := done(&http.Response{Header: header}); err != nil {
+		t.Fatal(err)
+	}
+
+	// All further acquisitions block on the server, until it rejects them.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rejected := make(chan struct{}, 1)
+	for i := 0; i < 2000; i++ {
+		go func() {
+			_, _, err := c.Acquire(ctx, inv)
+			if err != nil && strings.Contains(err.Error(), "too many messages in flight") {
+				select {
+				case rejected <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	select {
+	case <-rejected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server accepted every message")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	s := server.NewServer(server.WithTimeout(time.Hour))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(http.DefaultClient, u)
+
+	ctx := context.Background()
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+	}
+	done, _, err := c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- s.Drain(ctx)
+	}()
+
+	// Wait for draining to start, after which no quota is granted.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, cancel, err := c.Acquire(ctx, inv)
+		if err != nil {
+			break
+		}
+		cancel()
+		if time.Now().After(deadline) {
+			t.Fatal("acquire should fail while draining")
+		}
+	}
+
+	// Outstanding tokens can still be finalized.
+	if err := done(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not finish after all tokens were done")
+	}
+}
+
+func TestSharded(t *testing.T) {
+	var (
+		servers  []*httptest.Server
+		replicas []ratelimit.Limiter
+	)
+	for i := 0; i < 3; i++ {
+		ts := httptest.NewServer(server.New())
+		defer ts.Close()
+		u, err := url.Parse(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, ts)
+		replicas = append(replicas, client.New(http.DefaultClient, u))
+	}
+	c := client.NewSharded(replicas...)
+
+	ctx := context.Background()
+	inv := ratelimit.Invocation{
+		ApplicationKey: "key",
+		Region:         "NA1",
+	}
+
+	// owner returns the index of the server holding an outstanding token.
+	owner := func() int {
+		res := -1
+		for i, ts := range servers {
+			r, err := http.Get(ts.URL + "/status/tokens")
+			if err != nil {
+				continue
+			}
+			var tokens []json.RawMessage
+			err = json.NewDecoder(r.Body).Decode(&tokens)
+			r.Body.Close()
+			if err == nil && len(tokens) > 0 {
+				res = i
+			}
+		}
+		return res
+	}
+
+	_, cancel, err := c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := owner()
+	if first < 0 {
+		t.Fatal("no server holds the token")
+	}
+	if err := cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same bucket is routed to the same replica.
+	_, cancel, err = c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := owner(); got != first {
+		t.Errorf("bucket moved from replica %d to %d", first, got)
+	}
+	if err := cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bucket fails over when its owner dies.
+	servers[first].Close()
+	_, cancel, err = c.Acquire(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := owner(); got == first || got < 0 {
+		t.Errorf("got owner %d after replica %d died", got, first)
+	}
+	if err := cancel(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// namedReplica is a Limiter that records the keys of the buckets it owns.
+type namedReplica struct {
+	name  string
+	owned map[string]bool
+}
+
+func (r *namedReplica) String() string {
+	return r.name
+}
+
+func (r *namedReplica) Acquire(ctx context.Context, inv ratelimit.Invocation) (ratelimit.Done, ratelimit.Cancel, error) {
+	r.owned[inv.ApplicationKey] = true
+	return func(*http.Response) error { return nil }, func() error { return nil }, nil
+}
+
+func TestShardedStableOwners(t *testing.T) {
+	var replicas []*namedReplica
+	for _, name := range []string{"http://a", "http://b", "http://c"} {
+		replicas = append(replicas, &namedReplica{name: name, owned: make(map[string]bool)})
+	}
+	owners := func(rs ...*namedReplica) map[string]string {
+		var ls []ratelimit.Limiter
+		for _, r := range rs {
+			r.owned = make(map[string]bool)
+			ls = append(ls, r)
+		}
+		c := client.NewSharded(ls...)
+		for i := 0; i < 100; i++ {
+			if _, _, err := c.Acquire(context.Background(), ratelimit.Invocation{ApplicationKey: strconv.Itoa(i), Region: "NA1"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		res := make(map[string]string)
+		for _, r := range rs {
+			for key := range r.owned {
+				res[key] = r.name
+			}
+		}
+		return res
+	}
+
+	before := owners(replicas...)
+	// Remove the second replica and reverse the others.
+	after := owners(replicas[2], replicas[0])
+	moved := 0
+	for key, owner := range before {
+		if owner == replicas[1].name {
+			continue
+		}
+		if after[key] != owner {
+			moved++
+		}
+	}
+	if moved > 0 {
+		t.Errorf("%d buckets of the remaining replicas moved", moved)
+	}
+}
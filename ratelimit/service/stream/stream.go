@@ -0,0 +1,91 @@
+// Package stream defines the messages of the persistent stream transport
+// between rate limit clients and the rate limit server.
+//
+// A client opens a stream with an HTTP/1.1 request to /stream carrying the
+// headers "Connection: Upgrade" and "Upgrade: riot-ratelimit-stream/1". After
+// the server responds with HTTP Switching Protocols, both sides exchange
+// newline-delimited JSON Messages over the connection.
+//
+// The client sends acquire, done and cancel requests, each with a unique ID.
+// The server answers each request with a grant, ok or error message carrying
+// the same ID, in any order. For a done request with headers, the server
+// first pushes a limits message describing the updated application and method
+// limits, and then answers the request. The same limits message is pushed to
+// every other stream that has acquired quota for the application key and
+// region. A stream that falls too far behind on these pushes is closed. The
+// server answers requests with an error without processing them while too
+// many requests of the same stream are in progress.
+package stream
+
+import "time"
+
+// Protocol is the protocol named in the Upgrade header.
+const Protocol = "riot-ratelimit-stream/1"
+
+// Message types.
+const (
+	Acquire = "acquire"
+	Done    = "done"
+	Cancel  = "cancel"
+	Grant   = "grant"
+	OK      = "ok"
+	Error   = "error"
+	Limits  = "limits"
+)
+
+// Message is a single message sent on a stream in either direction. Fields
+// are only populated as needed by the message type.
+type Message struct {
+	Type string `json:"type"`
+
+	// ID matches responses to client requests. It is zero for server pushes.
+	ID uint64 `json:"id,omitempty"`
+
+	// Key, Region, Method, Uniquifier and NoAppQuota describe the invocation of
+	// an acquire request.
+	Key        string `json:"key,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Method     string `json:"method,omitempty"`
+	Uniquifier string `json:"uniquifier,omitempty"`
+	NoAppQuota bool   `json:"noAppQuota,omitempty"`
+
+	// HashedKey is true if Key is already ratelimit.KeyID of the application
+	// key.
+	HashedKey bool `json:"hashedKey,omitempty"`
+
+	// Token is the token granted by an acquire request, and the token to
+	// finalize for done and cancel requests.
+	Token string `json:"token,omitempty"`
+
+	// Header contains optional Riot API response headers for done requests.
+	Header map[string][]string `json:"header,omitempty"`
+
+	// Error describes why a request failed.
+	Error string `json:"error,omitempty"`
+
+	// Limits contains updated limits pushed by the server.
+	Limits []InvocationLimits `json:"limits,omitempty"`
+}
+
+// InvocationLimits describes the limits of an invocation pushed by the
+// server. Empty Method corresponds to application-level limits.
+type InvocationLimits struct {
+	Key        string     `json:"key"`
+	Region     string     `json:"region"`
+	Method     string     `json:"method,omitempty"`
+	Uniquifier string     `json:"uniquifier,omitempty"`
+	Limits     []Limit    `json:"limits"`
+	WakeUntil  *time.Time `json:"wakeUntil,omitempty"`
+
+	// ServiceWakeUntil and ServiceFailures describe backoff following service
+	// rate limit violations.
+	ServiceWakeUntil *time.Time `json:"serviceWakeUntil,omitempty"`
+	ServiceFailures  int        `json:"serviceFailures,omitempty"`
+}
+
+// Limit describes a single interval limit.
+type Limit struct {
+	Seconds   int64 `json:"seconds"`
+	Capacity  int64 `json:"capacity"`
+	Available int64 `json:"available"`
+}